@@ -2,7 +2,6 @@ package gateway
 
 import (
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strings"
 
@@ -25,9 +24,11 @@ type actionHandler struct {
 	settings             map[string]interface{}
 	acceptedMethodsCache map[string]bool
 	route                Route
+	paramsSchema         map[string]interface{}
 	router               *gin.RouterGroup
 	authenticate         *AuthenticateMethodsFunc
 	authorize            *AuthorizeMethodFunc
+	inFlight             *inFlightCalls
 }
 
 // aliasPath return the alias path(endpoint), if one exists for the action.
@@ -47,6 +48,23 @@ func (handler *actionHandler) aliasPath() string {
 	return ""
 }
 
+// aliasSettings returns the settings of the alias, if any.
+func (handler *actionHandler) aliasSettings() AliasSettings {
+	return handler.route.AliasSettings[handler.alias]
+}
+
+// endpointOwner describes what registered the path of the handler, used in the conflict logs.
+func (handler *actionHandler) endpointOwner() string {
+	route := handler.route.Name
+	if route == "" {
+		route = handler.route.Path
+	}
+	if handler.alias != "" {
+		return fmt.Sprintf("alias %q of route %s", handler.alias, route)
+	}
+	return fmt.Sprint("action ", handler.action, " of route ", route)
+}
+
 // pattern return the path pattern used to map URL in the http.ServeMux
 func (handler *actionHandler) getFullPath() string {
 	actionPath := strings.Replace(handler.action, ".", "/", -1)
@@ -65,22 +83,41 @@ func (handler *actionHandler) Handler() gin.HandlerFunc {
 
 	return func(ctx *gin.Context) {
 
+		// the response type is negotiated first, so the action is not called when it can't be answered.
+		serializers := responseSerializers(handler.route, handler.settings)
+		if len(serializers) > 1 {
+			ctx.Writer.Header().Add("Vary", "Accept")
+		}
+		serializer, acceptable := negotiateSerializer(ctx.GetHeader("Accept"), serializers)
+		if !acceptable {
+			handler.sendReponse(logger, notAcceptableError(ctx.GetHeader("Accept")), ctx)
+			return
+		}
+		ctx.Set(responseSerializerKey, serializer)
+
+		context := handler.newRequestContext(ctx)
+		ctx.Set(requestContextKey, context)
+
 		if handler.route.OnBeforeCall != nil {
-			(*handler.route.OnBeforeCall)(handler.context, ctx, handler.route, handler.alias)
+			(*handler.route.OnBeforeCall)(context, ctx, handler.route, handler.alias)
 		}
 
 		// Authentication call
 		if handler.route.Authentication && handler.authenticate != nil {
-			user := (*handler.authenticate)(handler.context, ctx, handler.alias)
+			user, err := (*handler.authenticate)(context, ctx, handler.alias)
+			if err != nil {
+				handler.sendReponse(logger, authError(err, "UNAUTHORIZED", http.StatusUnauthorized), ctx)
+				return
+			}
 			if user != nil {
-				handler.context.Logger().Debug("Authenticated user", user)
-				handler.context.Meta().AddMany(map[string]interface{}{
+				context.Logger().Debug("Authenticated user", user)
+				context.Meta().AddMany(map[string]interface{}{
 					"user": user,
 				})
 			} else {
 				// Anonymous user
-				handler.context.Logger().Debug("Anonymous user")
-				handler.context.Meta().AddMany(map[string]interface{}{
+				context.Logger().Debug("Anonymous user")
+				context.Meta().AddMany(map[string]interface{}{
 					"user": nil,
 				})
 			}
@@ -88,7 +125,10 @@ func (handler *actionHandler) Handler() gin.HandlerFunc {
 
 		// Authorization call
 		if handler.route.Authorization && handler.authorize != nil {
-			(*handler.authorize)(handler.context, ctx, handler.alias)
+			if err := (*handler.authorize)(context, ctx, handler.alias); err != nil {
+				handler.sendReponse(logger, authError(err, "FORBIDDEN", http.StatusForbidden), ctx)
+				return
+			}
 		}
 
 		logRequestFormatType, logRequestFormatTypeExists := handler.settings["logRequest"].(nucleo.LogLevelType)
@@ -97,7 +137,24 @@ func (handler *actionHandler) Handler() gin.HandlerFunc {
 			logRequestLogger("Call '", handler.action, "' action")
 		}
 
-		params := paramsFromRequest(ctx.Request, logger)
+		// the raw body is read before the body parsers consume it.
+		var rawBody []byte
+		if handler.aliasSettings().RawBody {
+			var err error
+			if rawBody, err = readRawBody(ctx.Request); err != nil {
+				handler.sendReponse(logger, bodyError(ctx.Request, err, logger), ctx)
+				return
+			}
+		}
+
+		params := paramsFromRequest(ctx, handler.route, handler.settings, handler.paramsSchema, logger)
+		if _, isAnError := resultIsAnError(params); isAnError {
+			handler.sendReponse(logger, params, ctx)
+			return
+		}
+		if handler.aliasSettings().RawBody {
+			params = withRawRequest(params, rawBody, ctx.Request.Header)
+		}
 
 		logRequestParamsFormatType, logRequestParamsFormatTypeExists := handler.settings["logRequestParams"].(nucleo.LogLevelType)
 		if logRequestParamsFormatTypeExists {
@@ -105,7 +162,14 @@ func (handler *actionHandler) Handler() gin.HandlerFunc {
 			logRequestParamsLogger("Params: ", params)
 		}
 
-		callActionResponse := <-handler.context.Call(handler.action, params)
+		inFlightID := handler.inFlight.add(handler.action, ctx.Request.URL.Path)
+		var callActionResponse nucleo.Payload
+		if streamsUploads(handler.route, ctx.Request) {
+			callActionResponse = handler.callWithUploads(ctx, logger)
+		} else {
+			callActionResponse = <-context.Call(handler.action, params)
+		}
+		handler.inFlight.remove(inFlightID)
 
 		logResponseDataFormatType, logResponseDataFormatTypeExists := handler.settings["logResponseData"].(nucleo.LogLevelType)
 		if logResponseDataFormatTypeExists {
@@ -114,7 +178,7 @@ func (handler *actionHandler) Handler() gin.HandlerFunc {
 		}
 
 		if handler.route.OnAfterCall != nil {
-			(*handler.route.OnAfterCall)(handler.context, ctx, handler.route, callActionResponse)
+			(*handler.route.OnAfterCall)(context, ctx, handler.route, callActionResponse)
 		}
 
 		handler.sendReponse(logger, callActionResponse, ctx)
@@ -128,43 +192,91 @@ var errorStatusCode = 500
 func (handler *actionHandler) responesErrorHandler(ginContext *gin.Context, result nucleo.Payload) {
 	logger := handler.context.Logger()
 
-	ginContext.Writer.WriteHeader(errorStatusCode)
+	nucleoError, _ := result.Value().(errors.NucleoError)
+	statusCode := handler.errorStatus(nucleoError)
 
-	log4XXResponses, log4XXResponsesExists := handler.settings["log4XXResponses"].(nucleo.LogLevelType)
-	if log4XXResponsesExists {
-		log4XXResponsesLogger := getLogger(log4XXResponses, logger)
-		log4XXResponsesLogger("Gateway  Request error! - action: ", handler.action, " error ", result.Error())
+	if statusCode >= 500 {
+		logger.Errorln("Gateway  Request error! - action: ", handler.action, " status: ", statusCode, " error ", nucleoError.Message)
+	} else {
+		log4XXResponses, log4XXResponsesExists := handler.settings["log4XXResponses"].(nucleo.LogLevelType)
+		if log4XXResponsesExists {
+			log4XXResponsesLogger := getLogger(log4XXResponses, logger)
+			log4XXResponsesLogger("Gateway  Request error! - action: ", handler.action, " status: ", statusCode, " error ", nucleoError.Message)
+		}
 	}
 
-	onError, onErrorExists := handler.settings["onError"].(func(context *gin.Context, response nucleo.Payload))
+	// the alias and route error handlers override the global onError setting.
+	onError := handler.aliasSettings().OnError
+	if onError == nil {
+		onError = handler.route.OnError
+	}
+	if onError != nil {
+		ginContext.Writer.Header().Set("Content-Type", handler.responseSerializer(ginContext).ContentType())
+		ginContext.Writer.WriteHeader(statusCode)
+		(*onError)(handler.requestContext(ginContext), ginContext, handler.route, handler.alias, nucleoError)
+		return
+	}
+
+	globalOnError, globalOnErrorExists := handler.settings["onError"].(func(context *gin.Context, response nucleo.Payload))
 
 	// if user has onError middleware configured, they will be able to override it.
-	if onErrorExists {
-		onError(ginContext, result)
+	if globalOnErrorExists {
+		ginContext.Writer.Header().Set("Content-Type", handler.responseSerializer(ginContext).ContentType())
+		ginContext.Writer.WriteHeader(statusCode)
+		globalOnError(ginContext, result)
 	} else {
-		// return response.
-		json := jsonSerializer.PayloadToBytes(payload.Empty().Add("error", result.Error().Error()))
-		ginContext.Writer.Write(json)
+		handler.writeResponse(logger, ginContext, statusCode, handler.errorBody(ginContext, nucleoError, statusCode))
 	}
 }
 
 // sendReponse send the result payload  back using the ResponseWriter
 func (handler *actionHandler) sendReponse(logger *log.Entry, result nucleo.Payload, ginContext *gin.Context) {
-	// Return with a JSON object
-	ginContext.Writer.Header().Add("Content-Type", "application/json; charset=utf-8")
-
 	nucleoError, nucleoErrorExists := resultIsAnError(result)
 	if nucleoErrorExists {
 		handler.responesErrorHandler(ginContext, *nucleoError)
 		return
 	}
 
-	var json []byte
-	ginContext.Writer.WriteHeader(succesStatusCode)
-	json = jsonSerializer.PayloadToBytes(result)
+	if isStream(result.Value()) {
+		handler.writeStream(logger, ginContext, result.Value())
+		return
+	}
 
-	logger.Debug("Gateway SendReponse() - action: ", handler.action, " json: ", string(json))
-	ginContext.Writer.Write(json)
+	statusCode := handler.applyResponseMeta(logger, ginContext)
+	if !bodyAllowed(statusCode) || (result.Value() == nil && statusCode >= 300 && statusCode < 400) {
+		ginContext.Writer.WriteHeader(statusCode)
+		return
+	}
+
+	// text results with their own content type (e.g. html) are written as is.
+	if text, isText := result.Value().(string); isText && metaString(handler.requestContext(ginContext).Meta(), "$responseType") != "" {
+		ginContext.Writer.WriteHeader(statusCode)
+		ginContext.Writer.WriteString(text)
+		return
+	}
+
+	handler.writeResponse(logger, ginContext, statusCode, result.Value())
+}
+
+// writeResponse encodes the value with the serializer negotiated for the request.
+func (handler *actionHandler) writeResponse(logger *log.Entry, ginContext *gin.Context, statusCode int, value interface{}) {
+	serializer := handler.responseSerializer(ginContext)
+
+	body, err := serializer.Serialize(value)
+	if err != nil {
+		logger.Errorln("Gateway could not serialize the response - action: ", handler.action, " content type: ", serializer.ContentType(), " error: ", err)
+		ginContext.Writer.WriteHeader(errorStatusCode)
+		return
+	}
+
+	// the action can override the content type with $responseType.
+	if ginContext.Writer.Header().Get("Content-Type") == "" {
+		ginContext.Writer.Header().Set("Content-Type", serializer.ContentType())
+	}
+	ginContext.Writer.WriteHeader(statusCode)
+
+	logger.Debug("Gateway SendReponse() - action: ", handler.action, " body: ", string(body))
+	ginContext.Writer.Write(body)
 }
 
 // acceptedMethods return a map of accepted methods for this handler.
@@ -205,40 +317,6 @@ func validMethod(method string) bool {
 	return false
 }
 
-func paramsFromRequestForm(request *http.Request, logger *log.Entry) (map[string]interface{}, error) {
-	params := map[string]interface{}{}
-	err := request.ParseForm()
-	if err != nil {
-		logger.Errorln("Error calling request.ParseForm() -> ", err)
-		return nil, err
-	}
-	for name, value := range request.Form {
-		if len(value) == 1 {
-			params[name] = value[0]
-		} else {
-			params[name] = value
-		}
-	}
-	return params, nil
-}
-
-// paramsFromRequest extract params from body and URL into a payload.
-func paramsFromRequest(request *http.Request, logger *log.Entry) nucleo.Payload {
-	mvalues, err := paramsFromRequestForm(request, logger)
-	if len(mvalues) > 0 {
-		return payload.New(mvalues)
-	}
-	if err != nil {
-		return payload.Error("Error trying to parse request form values. Error: ", err.Error())
-	}
-
-	bts, err := ioutil.ReadAll(request.Body)
-	if err != nil {
-		return payload.Error("Error trying to parse request body. Error: ", err.Error())
-	}
-	return jsonSerializer.BytesToPayload(&bts)
-}
-
 func getLogger(logType nucleo.LogLevelType, existingLogger *log.Entry) func(args ...interface{}) {
 
 	if logType == nucleo.LogLevelWarn {
@@ -290,14 +368,15 @@ func resultIsAnError(result nucleo.Payload) (*nucleo.Payload, bool) {
 		return &errorPayload, true
 	}
 
+	// errors without a type, e.g. raised by the broker when the action is not available.
 	if result.IsError() {
 		errorMessage := result.Error().Error()
-		errorCode := 400
+		errorType := plainErrorType(errorMessage)
+		errorCode := defaultErrorStatusCodes[errorType]
 		nucleoError := errors.NewNucleoError(errors.NewNucleoErrorInput{
 			Message: &errorMessage,
 			Code:    &errorCode,
-			Type:    "CLIENT_ERROR",
-			Data:    map[string]interface{}{},
+			Type:    errorType,
 		})
 		errorPayload := payload.New(nucleoError)
 		return &errorPayload, true
@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Bendomey/nucleo-go"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConcurrentRequestsKeepTheirMeta(t *testing.T) {
+	users := nucleo.ServiceSchema{
+		Name: "users",
+		Actions: []nucleo.Action{
+			{Name: "me", Handler: func(context nucleo.Context, params nucleo.Payload) interface{} {
+				user := context.Meta().Get("user").String()
+				context.Meta().Add("$statusCode", params.Get("status").Int())
+				// the requests overlap while the meta is read and written.
+				time.Sleep(20 * time.Millisecond)
+				return map[string]interface{}{"user": user, "requestID": context.(nucleo.BrokerContext).RequestID()}
+			}},
+		},
+	}
+	authenticate := func(context nucleo.Context, ginContext *gin.Context, alias string) (interface{}, error) {
+		return ginContext.GetHeader("X-User"), nil
+	}
+
+	handler := startGateway(t, GatewayMixin{Authenticate: &authenticate}, map[string]interface{}{
+		"routes": []Route{{Path: "/api", Authentication: true, Aliases: map[string]string{"GET /me": "users.me"}}},
+	}, users)
+
+	statusCodes := []int{http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNonAuthoritativeInfo}
+	requests := 20
+	recorders := make([]*httptest.ResponseRecorder, requests)
+	var waitGroup sync.WaitGroup
+	for index := 0; index < requests; index++ {
+		waitGroup.Add(1)
+		go func(index int) {
+			defer waitGroup.Done()
+			request := httptest.NewRequest(http.MethodGet, fmt.Sprint("/api/me?status=", statusCodes[index%len(statusCodes)]), nil)
+			request.Header.Set("X-User", fmt.Sprint("user-", index))
+			recorders[index] = httptest.NewRecorder()
+			handler.ServeHTTP(recorders[index], request)
+		}(index)
+	}
+	waitGroup.Wait()
+
+	requestIDs := map[string]bool{}
+	for index, recorder := range recorders {
+		if expected := statusCodes[index%len(statusCodes)]; recorder.Code != expected {
+			t.Errorf("request %d: status code %d, expected %d", index, recorder.Code, expected)
+		}
+		response := map[string]string{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("request %d: invalid response %s", index, recorder.Body.String())
+		}
+		if expected := fmt.Sprint("user-", index); response["user"] != expected {
+			t.Errorf("request %d: user %q, expected %q", index, response["user"], expected)
+		}
+		if response["requestID"] == "" || requestIDs[response["requestID"]] {
+			t.Errorf("request %d: request id %q is empty or shared", index, response["requestID"])
+		}
+		requestIDs[response["requestID"]] = true
+	}
+}
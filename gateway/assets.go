@@ -0,0 +1,229 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Assets struct {
+	// Path the files are served under, relative to the gateway base path.
+	Path string
+
+	// Folder on disk to serve. Ignored when FS is set.
+	Folder string
+
+	// File system to serve, e.g. an embed.FS. Use fs.Sub to serve one of its sub folders.
+	FS fs.FS
+
+	// Index file served for folders (defaults to index.html).
+	Index string
+
+	// Cache-Control max-age of the files. When 0, clients have to revalidate every time (no-cache).
+	MaxAge time.Duration
+
+	// Serve the precompressed .br/.gz variant of a file, when it exists and the client accepts it.
+	Precompressed bool
+
+	// Serve the index file for unknown paths without a file extension, so single page apps can handle their own routing.
+	SPAFallback bool
+
+	// name -> ETag of the files without a modification time, hashed once.
+	etags *sync.Map
+}
+
+// precompressedEncodings in the order of preference.
+var precompressedEncodings = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// registerAssets serves the static files for the paths not handled by the actions, so assets
+// can share their path with the actions (e.g. a single page app served from "/").
+func (svc *GatewayService) registerAssets(mainRouter *gin.Engine, basePath string) {
+	assetsSettings, exists := svc.settings["assets"].([]Assets)
+	if !exists || len(assetsSettings) == 0 {
+		return
+	}
+
+	assets := make([]Assets, len(assetsSettings))
+	for index, asset := range assetsSettings {
+		asset.Path = path.Join("/", basePath, asset.Path)
+		if asset.FS == nil {
+			asset.FS = os.DirFS(asset.Folder)
+		}
+		if asset.Index == "" {
+			asset.Index = "index.html"
+		}
+		asset.etags = &sync.Map{}
+		assets[index] = asset
+	}
+
+	// the most specific paths first
+	sort.SliceStable(assets, func(i, j int) bool {
+		return len(assets[i].Path) > len(assets[j].Path)
+	})
+
+	mainRouter.NoRoute(func(ginContext *gin.Context) {
+		if ginContext.Request.Method != http.MethodGet && ginContext.Request.Method != http.MethodHead {
+			return
+		}
+		for _, asset := range assets {
+			name, matches := asset.fileName(ginContext.Request.URL.Path)
+			if matches && asset.serve(ginContext, name) {
+				return
+			}
+		}
+	})
+}
+
+// fileName returns the name of the requested file within the assets file system.
+func (asset Assets) fileName(requestPath string) (string, bool) {
+	requestPath = path.Clean("/" + requestPath)
+	if asset.Path != "/" && requestPath != asset.Path && !strings.HasPrefix(requestPath, asset.Path+"/") {
+		return "", false
+	}
+
+	name := strings.TrimPrefix(strings.TrimPrefix(requestPath, asset.Path), "/")
+	if name == "" {
+		name = "."
+	}
+	return name, fs.ValidPath(name)
+}
+
+// serve writes the file to the response. Returns false when there is nothing to serve.
+func (asset Assets) serve(ginContext *gin.Context, name string) bool {
+	info, err := fs.Stat(asset.FS, name)
+	if err == nil && info.IsDir() {
+		name = path.Join(name, asset.Index)
+		info, err = fs.Stat(asset.FS, name)
+	}
+
+	isIndex := path.Base(name) == asset.Index
+	if err != nil || info.IsDir() {
+		// missing files (e.g. /app.js) are not replaced by the index, only app paths are.
+		if !asset.SPAFallback || path.Ext(name) != "" {
+			return false
+		}
+		name = asset.Index
+		isIndex = true
+	}
+
+	servedName, encoding := name, ""
+	if asset.Precompressed {
+		acceptEncoding := ginContext.GetHeader("Accept-Encoding")
+		for _, precompressed := range precompressedEncodings {
+			if !acceptsEncoding(acceptEncoding, precompressed.encoding) {
+				continue
+			}
+			if _, err := fs.Stat(asset.FS, name+precompressed.extension); err == nil {
+				servedName, encoding = name+precompressed.extension, precompressed.encoding
+				break
+			}
+		}
+	}
+
+	file, err := asset.FS.Open(servedName)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	info, err = file.Stat()
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	content, isSeeker := file.(io.ReadSeeker)
+	etag := fmt.Sprintf(`W/"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+
+	// files without a modification time (e.g. embed.FS) are identified by their content, hashed on the first request.
+	if info.ModTime().IsZero() {
+		if cached, exists := asset.etags.Load(servedName); exists {
+			etag = cached.(string)
+		} else {
+			data, err := io.ReadAll(file)
+			if err != nil {
+				return false
+			}
+			content, isSeeker = bytes.NewReader(data), true
+			hash := sha256.Sum256(data)
+			etag = fmt.Sprintf(`"%x"`, hash[:16])
+			asset.etags.Store(servedName, etag)
+		}
+	}
+	if !isSeeker {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return false
+		}
+		content = bytes.NewReader(data)
+	}
+
+	// the headers are only set once the file is opened, so they don't leak into the 404 of the next handlers.
+	header := ginContext.Writer.Header()
+
+	// the index of a single page app must always be revalidated, so new deployments are picked up.
+	if asset.MaxAge > 0 && !isIndex {
+		header.Set("Cache-Control", fmt.Sprint("public, max-age=", int(asset.MaxAge.Seconds())))
+	} else {
+		header.Set("Cache-Control", "no-cache")
+	}
+	if asset.Precompressed {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+	}
+	header.Set("ETag", etag)
+
+	// ServeContent handles the conditional (If-None-Match/If-Modified-Since) and range requests.
+	// The content type is detected from the original name, not the precompressed one.
+	http.ServeContent(ginContext.Writer, ginContext.Request, name, info.ModTime(), content)
+	return true
+}
+
+// acceptsEncoding returns true when the Accept-Encoding header accepts the encoding: listed, or
+// matched by "*", with a non zero quality. The entry of the encoding wins over "*".
+func acceptsEncoding(acceptEncoding string, encoding string) bool {
+	wildcard := false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.TrimSpace(coding)
+
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(param, "=")
+			if strings.EqualFold(strings.TrimSpace(key), "q") {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					quality = parsed
+				} else {
+					quality = 0
+				}
+			}
+		}
+
+		if strings.EqualFold(coding, encoding) {
+			return quality > 0
+		}
+		if coding == "*" {
+			wildcard = quality > 0
+		}
+	}
+	return wildcard
+}
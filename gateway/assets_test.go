@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		encoding       string
+		expected       bool
+	}{
+		{"gzip, deflate, br", "br", true},
+		{"gzip, deflate", "br", false},
+		{"", "gzip", false},
+		{"gzip;q=0", "gzip", false},
+		{"gzip; q=0.5", "gzip", true},
+		{"GZIP", "gzip", true},
+		{"*", "br", true},
+		{"*;q=0", "br", false},
+		{"br;q=0, *", "br", false},
+		{"gzip, *;q=0", "gzip", true},
+		{"gzip;q=abc", "gzip", false},
+	}
+
+	for _, test := range tests {
+		if accepted := acceptsEncoding(test.acceptEncoding, test.encoding); accepted != test.expected {
+			t.Errorf("acceptsEncoding(%q, %q) = %v, expected %v", test.acceptEncoding, test.encoding, accepted, test.expected)
+		}
+	}
+}
+
+func serveAsset(asset Assets, name string, headers map[string]string) (*httptest.ResponseRecorder, bool) {
+	recorder := httptest.NewRecorder()
+	ginContext, _ := gin.CreateTestContext(recorder)
+	ginContext.Request = httptest.NewRequest(http.MethodGet, "/"+name, nil)
+	for key, value := range headers {
+		ginContext.Request.Header.Set(key, value)
+	}
+	served := asset.serve(ginContext, name)
+	// gin writes the header-only responses (e.g. 304) once the handlers are done.
+	ginContext.Writer.WriteHeaderNow()
+	return recorder, served
+}
+
+func TestAssetsServe(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	files := fstest.MapFS{
+		"app.js":    {Data: []byte("console.log(1)")},
+		"app.js.gz": {Data: []byte("gzipped")},
+	}
+	asset := Assets{FS: files, Index: "index.html", Precompressed: true, etags: &sync.Map{}}
+
+	recorder, served := serveAsset(asset, "missing.js", map[string]string{"Accept-Encoding": "gzip"})
+	if served {
+		t.Fatal("missing file served")
+	}
+	for _, header := range []string{"Cache-Control", "Vary", "Content-Encoding", "ETag"} {
+		if value := recorder.Header().Get(header); value != "" {
+			t.Errorf("missing file: header %s = %q, expected none", header, value)
+		}
+	}
+
+	recorder, _ = serveAsset(asset, "app.js", map[string]string{"Accept-Encoding": "gzip;q=0"})
+	if encoding := recorder.Header().Get("Content-Encoding"); encoding != "" || recorder.Body.String() != "console.log(1)" {
+		t.Errorf("gzip;q=0: served %q with encoding %q, expected the plain file", recorder.Body.String(), encoding)
+	}
+
+	recorder, _ = serveAsset(asset, "app.js", map[string]string{"Accept-Encoding": "gzip"})
+	if encoding := recorder.Header().Get("Content-Encoding"); encoding != "gzip" || recorder.Body.String() != "gzipped" {
+		t.Errorf("gzip: served %q with encoding %q, expected the gzipped file", recorder.Body.String(), encoding)
+	}
+
+	recorder, _ = serveAsset(asset, "app.js", nil)
+	etag := recorder.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag for a file without modification time")
+	}
+
+	// the ETag is hashed once, the content is not read again.
+	files["app.js"].Data = []byte("console.log(2)")
+	recorder, _ = serveAsset(asset, "app.js", map[string]string{"If-None-Match": etag})
+	if recorder.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: status %d, expected %d", recorder.Code, http.StatusNotModified)
+	}
+}
@@ -0,0 +1,43 @@
+package gateway
+
+import (
+	goErrors "errors"
+	"net/http"
+
+	"github.com/Bendomey/nucleo-go"
+	"github.com/Bendomey/nucleo-go/errors"
+	"github.com/Bendomey/nucleo-go/payload"
+)
+
+// authError returns the error answered when the Authenticate or Authorize hook rejects the request.
+// Nucleo errors returned by the hooks keep their type (defaulting to the given one), other errors
+// are answered with the given type and status code.
+func authError(err error, errorType string, statusCode int) nucleo.Payload {
+	var nucleoError *errors.NucleoError
+	var clientError *errors.NucleoClientError
+	// the hooks may return shared errors, the type is defaulted on a copy.
+	switch {
+	case goErrors.As(err, &nucleoError):
+		answered := *nucleoError
+		if answered.Type == "" {
+			answered.Type = errorType
+		}
+		return payload.New(answered)
+	case goErrors.As(err, &clientError):
+		answered := *clientError
+		if answered.Type == "" {
+			answered.Type = errorType
+		}
+		return payload.New(answered)
+	}
+
+	message := err.Error()
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+	return payload.New(errors.NewNucleoClientError(errors.NewNucleoClientErrorInput{
+		Message: &message,
+		Code:    &statusCode,
+		Type:    errorType,
+	}))
+}
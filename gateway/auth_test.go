@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	goErrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Bendomey/nucleo-go"
+	"github.com/Bendomey/nucleo-go/errors"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthErrorKeepsSharedErrors(t *testing.T) {
+	shared := &errors.NucleoClientError{NucleoError: errors.NucleoError{Message: "token expired", Code: 419}}
+
+	answered := authError(shared, "UNAUTHORIZED", http.StatusUnauthorized).Value().(errors.NucleoClientError)
+	if answered.Type != "UNAUTHORIZED" || answered.Code != 419 {
+		t.Errorf("answered %s %d, expected UNAUTHORIZED 419", answered.Type, answered.Code)
+	}
+	if shared.Type != "" {
+		t.Errorf("the returned error type was changed to %q", shared.Type)
+	}
+
+	plain := authError(goErrors.New(""), "FORBIDDEN", http.StatusForbidden).Value().(errors.NucleoClientError)
+	if plain.Type != "FORBIDDEN" || plain.Code != http.StatusForbidden || plain.Message != "Forbidden" {
+		t.Errorf("plain error answered %s %d %q, expected FORBIDDEN 403 \"Forbidden\"", plain.Type, plain.Code, plain.Message)
+	}
+}
+
+func TestAuthHooks(t *testing.T) {
+	users := nucleo.ServiceSchema{
+		Name: "users",
+		Actions: []nucleo.Action{
+			{Name: "me", Handler: func(context nucleo.Context, params nucleo.Payload) interface{} {
+				return context.Meta().Get("user").String()
+			}},
+		},
+	}
+	authenticate := func(context nucleo.Context, ginContext *gin.Context, alias string) (interface{}, error) {
+		token := ginContext.GetHeader("Authorization")
+		if token == "" {
+			return nil, goErrors.New("missing token")
+		}
+		return token, nil
+	}
+	authorize := func(context nucleo.Context, ginContext *gin.Context, alias string) error {
+		if context.Meta().Get("user").String() != "admin" {
+			return goErrors.New("admins only")
+		}
+		return nil
+	}
+
+	handler := startGateway(t, GatewayMixin{Authenticate: &authenticate, Authorize: &authorize}, map[string]interface{}{
+		"routes": []Route{{Path: "/api", Authentication: true, Authorization: true, Aliases: map[string]string{"GET /me": "users.me"}}},
+	}, users)
+
+	tests := []struct {
+		token      string
+		statusCode int
+		body       string
+	}{
+		{"", http.StatusUnauthorized, "missing token"},
+		{"guest", http.StatusForbidden, "admins only"},
+		{"admin", http.StatusOK, "admin"},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+		if test.token != "" {
+			request.Header.Set("Authorization", test.token)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != test.statusCode || !strings.Contains(recorder.Body.String(), test.body) {
+			t.Errorf("token %q: %d %s, expected %d with %s", test.token, recorder.Code, recorder.Body.String(), test.statusCode, test.body)
+		}
+	}
+}
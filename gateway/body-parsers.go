@@ -0,0 +1,208 @@
+package gateway
+
+import (
+	"encoding/json"
+	goErrors "errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/ugorji/go/codec"
+)
+
+// BodyParser parses the request bodies of the content types it handles into params.
+// Parsers returning url.Values are parsed with the route query parser, like the query string.
+type BodyParser interface {
+	// ContentTypes handled by the parser. Accepts wildcards, e.g. "text/*" or "application/*+json".
+	ContentTypes() []string
+
+	// Parse returns the params of the request body.
+	Parse(request *http.Request) (interface{}, error)
+}
+
+// errUnsupportedMediaType is returned when none of the body parsers handles the request content type.
+var errUnsupportedMediaType = goErrors.New("unsupported media type")
+
+// defaultBodyParsers is the "bodyParsers" default setting, used when neither the route nor the settings set the body parsers.
+var defaultBodyParsers = []BodyParser{JSONBodyParser{}, URLEncodedBodyParser{}, MultipartBodyParser{}}
+
+// bodyParsers returns the route body parsers, or the global ones.
+func bodyParsers(route Route, settings map[string]interface{}) []BodyParser {
+	if route.BodyParsers != nil {
+		return route.BodyParsers
+	}
+	parsers, exists := settings["bodyParsers"].([]BodyParser)
+	if exists {
+		return parsers
+	}
+	return defaultBodyParsers
+}
+
+// parseBody parses the request body with the first parser handling its content type.
+// Requests without a content type are parsed as json. Returns nil when the request has no body.
+func parseBody(request *http.Request, parsers []BodyParser) (interface{}, error) {
+	if request.Body == nil || request.Body == http.NoBody || request.ContentLength == 0 {
+		return nil, nil
+	}
+
+	contentType := "application/json"
+	if header := request.Header.Get("Content-Type"); header != "" {
+		mediaType, _, err := mime.ParseMediaType(header)
+		if err != nil {
+			return nil, errUnsupportedMediaType
+		}
+		contentType = mediaType
+	}
+
+	for _, parser := range parsers {
+		for _, pattern := range parser.ContentTypes() {
+			if matches, _ := path.Match(pattern, contentType); matches {
+				return parser.Parse(request)
+			}
+		}
+	}
+	return nil, errUnsupportedMediaType
+}
+
+// readBody returns the request body, or nil when it is empty.
+func readBody(request *http.Request) ([]byte, error) {
+	bts, err := io.ReadAll(request.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(string(bts))) == 0 {
+		return nil, nil
+	}
+	return bts, nil
+}
+
+// JSONBodyParser parses json bodies.
+type JSONBodyParser struct{}
+
+func (JSONBodyParser) ContentTypes() []string {
+	return []string{"application/json", "application/*+json"}
+}
+
+func (JSONBodyParser) Parse(request *http.Request) (interface{}, error) {
+	bts, err := readBody(request)
+	if err != nil || bts == nil {
+		return nil, err
+	}
+	if !json.Valid(bts) {
+		return nil, goErrors.New("invalid json body")
+	}
+	return jsonSerializer.BytesToPayload(&bts).Value(), nil
+}
+
+// URLEncodedBodyParser parses url encoded forms.
+type URLEncodedBodyParser struct{}
+
+func (URLEncodedBodyParser) ContentTypes() []string {
+	return []string{"application/x-www-form-urlencoded"}
+}
+
+func (URLEncodedBodyParser) Parse(request *http.Request) (interface{}, error) {
+	if err := request.ParseForm(); err != nil {
+		return nil, err
+	}
+	return request.PostForm, nil
+}
+
+// MultipartBodyParser parses the fields of multipart forms.
+type MultipartBodyParser struct {
+	// Size of the form kept in memory, the rest is stored in temporary files (defaults to 32MB).
+	MaxMemory int64
+}
+
+func (MultipartBodyParser) ContentTypes() []string {
+	return []string{"multipart/form-data"}
+}
+
+func (parser MultipartBodyParser) Parse(request *http.Request) (interface{}, error) {
+	maxMemory := parser.MaxMemory
+	if maxMemory <= 0 {
+		maxMemory = 32 << 20
+	}
+	if err := request.ParseMultipartForm(maxMemory); err != nil {
+		return nil, err
+	}
+	return url.Values(request.MultipartForm.Value), nil
+}
+
+// msgpack and cbor maps are decoded with string keys, like json objects.
+var mapType = reflect.TypeOf(map[string]interface{}(nil))
+
+// MessagePackBodyParser parses MessagePack bodies.
+type MessagePackBodyParser struct{}
+
+func (MessagePackBodyParser) ContentTypes() []string {
+	return []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"}
+}
+
+func (MessagePackBodyParser) Parse(request *http.Request) (interface{}, error) {
+	handle := &codec.MsgpackHandle{}
+	handle.MapType = mapType
+	handle.RawToString = true
+	return decodeBody(request, handle)
+}
+
+// CBORBodyParser parses CBOR bodies.
+type CBORBodyParser struct{}
+
+func (CBORBodyParser) ContentTypes() []string {
+	return []string{"application/cbor"}
+}
+
+func (CBORBodyParser) Parse(request *http.Request) (interface{}, error) {
+	handle := &codec.CborHandle{}
+	handle.MapType = mapType
+	return decodeBody(request, handle)
+}
+
+// decodeBody decodes the request body with the codec handle.
+func decodeBody(request *http.Request, handle codec.Handle) (interface{}, error) {
+	var value interface{}
+	if err := codec.NewDecoder(request.Body, handle).Decode(&value); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return value, nil
+}
+
+// TextBodyParser passes text bodies as a string.
+type TextBodyParser struct{}
+
+func (TextBodyParser) ContentTypes() []string {
+	return []string{"text/*"}
+}
+
+func (TextBodyParser) Parse(request *http.Request) (interface{}, error) {
+	bts, err := io.ReadAll(request.Body)
+	if err != nil {
+		return nil, err
+	}
+	return string(bts), nil
+}
+
+// RawBodyParser passes the body bytes as is.
+type RawBodyParser struct {
+	// Content types passed raw (defaults to application/octet-stream). Use "*/*" for all of them.
+	Types []string
+}
+
+func (parser RawBodyParser) ContentTypes() []string {
+	if len(parser.Types) == 0 {
+		return []string{"application/octet-stream"}
+	}
+	return parser.Types
+}
+
+func (RawBodyParser) Parse(request *http.Request) (interface{}, error) {
+	return io.ReadAll(request.Body)
+}
@@ -0,0 +1,139 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// decimalNumberRegex matches the decimal numbers, ParseFloat also accepts NaN, Inf and hex floats.
+var decimalNumberRegex = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// coerceParams converts the string values of the query, form and path params to the
+// types declared in the action params schema, e.g. {"a": "required,number"}.
+// Values that can't be converted are reported in fieldErrors, keyed by the field path.
+func coerceParams(params map[string]interface{}, schema map[string]interface{}, prefix string, fieldErrors map[string]interface{}) {
+	for name, rule := range schema {
+		value, exists := params[name]
+		if !exists || value == nil {
+			continue
+		}
+		field := prefix + name
+
+		switch rule := rule.(type) {
+		case string:
+			coerced, ok := coerceValue(value, strings.Split(rule, ","), field, fieldErrors)
+			if ok {
+				params[name] = coerced
+			}
+		case map[string]interface{}:
+			object, ok := coerceObject(value)
+			if !ok {
+				fieldErrors[field] = "must be an object"
+				continue
+			}
+			coerceParams(object, rule, field+".", fieldErrors)
+			params[name] = object
+		}
+	}
+}
+
+// coerceValue converts the value to the type of the schema tags. Tags after "dive" apply to the array items.
+func coerceValue(value interface{}, tags []string, field string, fieldErrors map[string]interface{}) (interface{}, bool) {
+	for index, tag := range tags {
+		if strings.TrimSpace(tag) != "dive" {
+			continue
+		}
+		items, ok := coerceArray(value)
+		if !ok {
+			fieldErrors[field] = "must be an array"
+			return nil, false
+		}
+		for itemIndex, item := range items {
+			coerced, ok := coerceValue(item, tags[index+1:], fmt.Sprint(field, "[", itemIndex, "]"), fieldErrors)
+			if ok {
+				items[itemIndex] = coerced
+			}
+		}
+		return items, true
+	}
+
+	text, isString := value.(string)
+	if !isString {
+		if _, isArray := value.([]interface{}); isArray && schemaType(tags) != "" {
+			fieldErrors[field] = "must be a single value"
+			return nil, false
+		}
+		// already typed, e.g. a json body value
+		return value, true
+	}
+
+	switch schemaType(tags) {
+	case "number":
+		text = strings.TrimSpace(text)
+		number, err := strconv.ParseFloat(text, 64)
+		// NaN and Inf can't be encoded in json.
+		if err != nil || !decimalNumberRegex.MatchString(text) || math.IsNaN(number) || math.IsInf(number, 0) {
+			fieldErrors[field] = "must be a number"
+			return nil, false
+		}
+		return number, true
+	case "boolean":
+		boolean, err := strconv.ParseBool(strings.TrimSpace(text))
+		if err != nil {
+			fieldErrors[field] = "must be a boolean"
+			return nil, false
+		}
+		return boolean, true
+	}
+	return value, true
+}
+
+// schemaType returns the type declared by the validation tags, or "" when there is nothing to convert.
+func schemaType(tags []string) string {
+	for _, tag := range tags {
+		switch strings.TrimSpace(tag) {
+		case "number", "numeric":
+			return "number"
+		case "boolean":
+			return "boolean"
+		}
+	}
+	return ""
+}
+
+// coerceArray returns the value as an array: repeated keys, a json array, or a single item.
+func coerceArray(value interface{}) ([]interface{}, bool) {
+	switch value := value.(type) {
+	case []interface{}:
+		return value, true
+	case string:
+		if strings.HasPrefix(strings.TrimSpace(value), "[") {
+			items := []interface{}{}
+			if err := json.Unmarshal([]byte(value), &items); err != nil {
+				return nil, false
+			}
+			return items, true
+		}
+		return []interface{}{value}, true
+	}
+	return nil, false
+}
+
+// coerceObject returns the value as an object, strings are parsed as json objects.
+func coerceObject(value interface{}) (map[string]interface{}, bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return value, true
+	case string:
+		object := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(value), &object); err != nil {
+			return nil, false
+		}
+		return object, true
+	}
+	return nil, false
+}
@@ -0,0 +1,85 @@
+package gateway
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCoerceParams(t *testing.T) {
+	tests := []struct {
+		name        string
+		params      map[string]interface{}
+		schema      map[string]interface{}
+		expected    map[string]interface{}
+		fieldErrors map[string]interface{}
+	}{
+		{
+			name:     "numbers and booleans",
+			params:   map[string]interface{}{"a": "1.5", "b": " 2 ", "ok": "true"},
+			schema:   map[string]interface{}{"a": "required,number", "b": "numeric", "ok": "boolean"},
+			expected: map[string]interface{}{"a": 1.5, "b": 2.0, "ok": true},
+		},
+		{
+			name:     "values without a type are kept",
+			params:   map[string]interface{}{"name": "john", "extra": "1"},
+			schema:   map[string]interface{}{"name": "required,min=2"},
+			expected: map[string]interface{}{"name": "john", "extra": "1"},
+		},
+		{
+			name:     "already typed values are kept",
+			params:   map[string]interface{}{"a": 3.0, "ok": false},
+			schema:   map[string]interface{}{"a": "number", "ok": "boolean"},
+			expected: map[string]interface{}{"a": 3.0, "ok": false},
+		},
+		{
+			name:     "dive converts the array items",
+			params:   map[string]interface{}{"ids": []interface{}{"1", "2"}, "single": "3", "json": "[4, 5]"},
+			schema:   map[string]interface{}{"ids": "dive,number", "single": "dive,number", "json": "dive,number"},
+			expected: map[string]interface{}{"ids": []interface{}{1.0, 2.0}, "single": []interface{}{3.0}, "json": []interface{}{4.0, 5.0}},
+		},
+		{
+			name:     "nested schemas",
+			params:   map[string]interface{}{"page": map[string]interface{}{"size": "10"}, "filter": `{"min": "2"}`},
+			schema:   map[string]interface{}{"page": map[string]interface{}{"size": "number"}, "filter": map[string]interface{}{"min": "number"}},
+			expected: map[string]interface{}{"page": map[string]interface{}{"size": 10.0}, "filter": map[string]interface{}{"min": 2.0}},
+		},
+		{
+			name:        "invalid values are reported",
+			params:      map[string]interface{}{"a": "x", "ok": "maybe", "ids": []interface{}{"1", "y"}, "b": []interface{}{"1", "2"}, "page": "[]"},
+			schema:      map[string]interface{}{"a": "number", "ok": "boolean", "ids": "dive,number", "b": "number", "page": map[string]interface{}{"size": "number"}},
+			expected:    map[string]interface{}{"a": "x", "ok": "maybe", "ids": []interface{}{1.0, "y"}, "b": []interface{}{"1", "2"}, "page": "[]"},
+			fieldErrors: map[string]interface{}{"a": "must be a number", "ok": "must be a boolean", "ids[1]": "must be a number", "b": "must be a single value", "page": "must be an object"},
+		},
+		{
+			name:        "only finite decimal numbers",
+			params:      map[string]interface{}{"nan": "NaN", "inf": "-Inf", "hex": "0x1p-2", "big": "1e400", "exp": "-1.5e3", "dot": ".5"},
+			schema:      map[string]interface{}{"nan": "number", "inf": "number", "hex": "number", "big": "number", "exp": "number", "dot": "number"},
+			expected:    map[string]interface{}{"nan": "NaN", "inf": "-Inf", "hex": "0x1p-2", "big": "1e400", "exp": -1500.0, "dot": 0.5},
+			fieldErrors: map[string]interface{}{"nan": "must be a number", "inf": "must be a number", "hex": "must be a number", "big": "must be a number"},
+		},
+		{
+			name:        "nested errors are keyed by path",
+			params:      map[string]interface{}{"page": map[string]interface{}{"size": "big"}},
+			schema:      map[string]interface{}{"page": map[string]interface{}{"size": "number"}},
+			expected:    map[string]interface{}{"page": map[string]interface{}{"size": "big"}},
+			fieldErrors: map[string]interface{}{"page.size": "must be a number"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fieldErrors := map[string]interface{}{}
+			coerceParams(test.params, test.schema, "", fieldErrors)
+
+			if !reflect.DeepEqual(test.params, test.expected) {
+				t.Errorf("params = %#v, expected %#v", test.params, test.expected)
+			}
+			if test.fieldErrors == nil {
+				test.fieldErrors = map[string]interface{}{}
+			}
+			if !reflect.DeepEqual(fieldErrors, test.fieldErrors) {
+				t.Errorf("field errors = %#v, expected %#v", fieldErrors, test.fieldErrors)
+			}
+		})
+	}
+}
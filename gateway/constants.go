@@ -1,7 +1,10 @@
 package gateway
 
 import (
+	"time"
+
 	"github.com/Bendomey/nucleo-go"
+	"github.com/Bendomey/nucleo-go/errors"
 	"github.com/gin-gonic/gin"
 )
 
@@ -39,12 +42,40 @@ type Route struct {
 	//aliases -> alias names instead of action names.
 	Aliases map[string]string
 
+	// Settings of the aliases, keyed by the alias, e.g. "POST /webhooks/stripe".
+	AliasSettings map[string]AliasSettings
+
+	// Order in which the params sources are merged, later sources override the previous ones.
+	// Defaults to the global paramsPrecedence setting (query, body, path).
+	ParamsPrecedence []ParamsSource
+
+	// Parsers of the request bodies, selected by Content-Type. Defaults to the global bodyParsers setting.
+	BodyParsers []BodyParser
+
+	// Stream the files of multipart requests to the action, one call per file. The file is passed
+	// in the $stream param (an io.Reader, local actions only) and its filename, mimetype and fieldname in the meta.
+	Uploads *UploadSettings
+
+	// Serializers of the responses, selected by the Accept header. The first one is the default.
+	// Defaults to the global responseSerializers setting.
+	ResponseSerializers []ResponseSerializer
+
+	// Convention used to parse the query string and form values. Defaults to the global queryParser setting.
+	QueryParser *QueryParser
+
+	// Keep the params sources separated: the action receives {"$query": {...}, "$body": ..., "$params": {...}}
+	SeparateParams bool
+
 	// This is called before action is called
 	OnBeforeCall *func(context nucleo.Context, ginContext *gin.Context, route Route, alias string)
 
 	// This is called after action is called but before response is sent to user.
 	OnAfterCall *func(context nucleo.Context, ginContext *gin.Context, route Route, response nucleo.Payload)
 
+	// Writes the error responses of the route, instead of the global onError setting. The status code
+	// and Content-Type are already set, the handler can still override them before writing the body.
+	OnError *func(context nucleo.Context, ginContext *gin.Context, route Route, alias string, err errors.NucleoError)
+
 	//authorization turn on/off authorization
 	Authorization bool
 
@@ -52,6 +83,15 @@ type Route struct {
 	Authentication bool
 }
 
+type AliasSettings struct {
+	// Pass the untouched request body in the $rawBody param ([]byte) and the request headers
+	// in the $headers param, alongside the parsed params. e.g. to verify webhook signatures.
+	RawBody bool
+
+	// Writes the error responses of the alias, instead of the route OnError.
+	OnError *func(context nucleo.Context, ginContext *gin.Context, route Route, alias string, err errors.NucleoError)
+}
+
 var defaultRoutes = []Route{
 	{
 		Name: "base-routes",
@@ -79,6 +119,45 @@ var defaultSettings = map[string]interface{}{
 	// Exposed IP
 	"ip": "0.0.0.0",
 
+	// Https settings. The server only serves plain http when this is nil.
+	"https": (*HttpsSettings)(nil),
+
+	// Start the built-in http server(s). Set to false when the gateway is embedded
+	// in an existing http server with Handler or Mount.
+	"server": true,
+
+	// Listeners. When empty, the gateway listens on ip:port (using the https settings, if any).
+	"listeners": []Listener{},
+
+	// Maximum duration for reading an entire request, including the body. 0 means no timeout.
+	"readTimeout": 30 * time.Second,
+
+	// Maximum duration for reading the request headers. Protects against slowloris-style clients.
+	"readHeaderTimeout": 10 * time.Second,
+
+	// Maximum duration before timing out writes of the response, counted from the end of the request headers,
+	// so it includes the action call. 0 means no timeout: a fixed default would cut off long running actions.
+	"writeTimeout": 0 * time.Second,
+
+	// Maximum duration to wait for the next request on keep-alive connections.
+	"idleTimeout": 120 * time.Second,
+
+	// Maximum size of the request headers in bytes.
+	"maxHeaderBytes": 1 << 20,
+
+	// Maximum number of concurrent connections per listener. 0 means no limit.
+	"maxConnections": 0,
+
+	// Readiness endpoint. Answers 503 while the gateway is starting or draining. Empty to disable.
+	"readinessPath": "/ready",
+
+	// How long the gateway keeps serving after being flagged not-ready on stop,
+	// so load balancers have time to notice.
+	"drainGracePeriod": 0 * time.Second,
+
+	// Maximum duration to wait for in-flight requests when shutting down.
+	"shutdownTimeout": 5 * time.Second,
+
 	// base path
 	"path": "/",
 
@@ -88,6 +167,26 @@ var defaultSettings = map[string]interface{}{
 	// Routes
 	"routes": defaultRoutes,
 
+	// Static files, served for the paths not handled by the routes.
+	"assets": []Assets{},
+
+	// Order in which the query, body and path params are merged into the action params.
+	// Later sources override the previous ones.
+	"paramsPrecedence": defaultParamsPrecedence,
+
+	// Keep the params sources separated under $query, $body and $params, instead of merging them.
+	"separateParams": false,
+
+	// Parsers of the request bodies, selected by Content-Type. Other content types are answered with 415.
+	"bodyParsers": defaultBodyParsers,
+
+	// Serializers of the responses, selected by the Accept header. The first one is used when the client
+	// accepts anything, requests accepting none of them are answered with 406.
+	"responseSerializers": defaultResponseSerializers,
+
+	// Convention used to parse the query string and form values into nested objects and arrays.
+	"queryParser": QueryParser{Brackets: true},
+
 	// Log each request (default to "info" level)
 	"logRequest": nucleo.LogLevelDebug,
 
@@ -100,15 +199,30 @@ var defaultSettings = map[string]interface{}{
 	// Log the response data (default to disable)
 	"logResponseData": nucleo.LogLevelInfo,
 
+	// Http status codes of the error types, e.g. {"MY_NOT_FOUND_ERROR": 404}. Types missing here use the
+	// default mapping: VALIDATION_ERROR -> 422, SERVICE_NOT_FOUND -> 404, REQUEST_TIMEOUT -> 504, SERVICE_NOT_AVAILABLE -> 503...
+	// Other errors use their code when it is a http error status, or 500.
+	"errorStatusCodes": map[string]int{},
+
+	// Answer errors with RFC 7807 problem details (application/problem+json) instead of {"error": "...", "data": ...}
+	"problemResponses": false,
+
+	// "onError": func(*gin.Context, nucleo.Payload) writes the error responses instead of the gateway.
+	// It has no default: an empty handler swallowed the error bodies.
+
 	// If set to true, it will log 4xx client errors, as well
 	"log4XXResponses": nucleo.LogLevelInfo,
 
 	// Log the route registration/aliases related activity
 	"logRouteRegistration": nucleo.LogLevelInfo,
 
+	// How long to wait after a service change event before rebuilding the routes,
+	// so a burst of changes (e.g. a rolling deploy) only triggers a single rebuild.
+	"routesRefreshDebounce": 500 * time.Millisecond,
+
+	// How often the registry is checked for service changes, in case a change event was missed. 0 to disable.
+	"routesRefreshInterval": 10 * time.Second,
+
 	// Optimize route order
 	"optimizeOrder": true,
-
-	// FIXME: parsing issue in nucleo-go
-	"onError": func(context *gin.Context, response nucleo.Payload) {},
 }
@@ -0,0 +1,96 @@
+package gateway
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Bendomey/nucleo-go/errors"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultErrorStatusCodes maps the error types to http status codes. Types missing from
+// the errorStatusCodes setting are looked up here.
+var defaultErrorStatusCodes = map[string]int{
+	"VALIDATION_ERROR":       http.StatusUnprocessableEntity,
+	"INVALID_BODY":           http.StatusBadRequest,
+	"UNAUTHORIZED":           http.StatusUnauthorized,
+	"FORBIDDEN":              http.StatusForbidden,
+	"NOT_FOUND":              http.StatusNotFound,
+	"SERVICE_NOT_FOUND":      http.StatusNotFound,
+	"NOT_ACCEPTABLE":         http.StatusNotAcceptable,
+	"PAYLOAD_TOO_LARGE":      http.StatusRequestEntityTooLarge,
+	"UNSUPPORTED_MEDIA_TYPE": http.StatusUnsupportedMediaType,
+	"RATE_LIMIT_EXCEEDED":    http.StatusTooManyRequests,
+	"INTERNAL_ERROR":         http.StatusInternalServerError,
+	"SERVICE_NOT_AVAILABLE":  http.StatusServiceUnavailable,
+	"REQUEST_TIMEOUT":        http.StatusGatewayTimeout,
+}
+
+// nodeDisconnectedError matches the error of the calls canceled because the node running the action left.
+var nodeDisconnectedError = regexp.MustCompile(`^Node .+ disconnected\. The request was canceled\.$`)
+
+// plainErrorType returns the type of an error without a type. Only the messages of the nucleo broker errors
+// are recognized, other errors (e.g. returned by the actions) are internal errors.
+func plainErrorType(message string) string {
+	switch {
+	case strings.HasPrefix(message, "Registry - endpoint not found"):
+		return "SERVICE_NOT_FOUND"
+	case message == "request timeout":
+		return "REQUEST_TIMEOUT"
+	case message == "can't complete request! registry stopping...", nodeDisconnectedError.MatchString(message):
+		return "SERVICE_NOT_AVAILABLE"
+	}
+	return "INTERNAL_ERROR"
+}
+
+// errorStatus returns the http status code of the error: from the errorStatusCodes setting by the
+// error type, or the error code when it is a valid http error status, or 500.
+func (handler *actionHandler) errorStatus(nucleoError errors.NucleoError) int {
+	if statusCodes, exists := handler.settings["errorStatusCodes"].(map[string]int); exists {
+		if statusCode, exists := statusCodes[nucleoError.Type]; exists {
+			return statusCode
+		}
+	}
+	if statusCode, exists := defaultErrorStatusCodes[nucleoError.Type]; exists {
+		return statusCode
+	}
+	if nucleoError.Code >= 400 && nucleoError.Code <= 599 {
+		return nucleoError.Code
+	}
+	return errorStatusCode
+}
+
+// errorBody returns the body of the error response: {"error": message, "data": data}, or a
+// RFC 7807 problem when the problemResponses setting is on.
+func (handler *actionHandler) errorBody(ginContext *gin.Context, nucleoError errors.NucleoError, statusCode int) interface{} {
+	if problem, _ := handler.settings["problemResponses"].(bool); problem {
+		body := map[string]interface{}{
+			"type":     nucleoError.Type,
+			"title":    http.StatusText(statusCode),
+			"status":   statusCode,
+			"detail":   nucleoError.Message,
+			"code":     nucleoError.Code,
+			"instance": ginContext.Request.URL.Path,
+		}
+		if nucleoError.Data != nil {
+			body["data"] = nucleoError.Data
+		}
+
+		// application/json -> application/problem+json, application/xml -> application/problem+xml
+		contentType := handler.responseSerializer(ginContext).ContentType()
+		for _, format := range []string{"json", "xml"} {
+			if strings.HasPrefix(contentType, "application/"+format) {
+				contentType = "application/problem+" + format
+			}
+		}
+		ginContext.Writer.Header().Set("Content-Type", contentType)
+		return body
+	}
+
+	body := map[string]interface{}{"error": nucleoError.Message}
+	if nucleoError.Data != nil {
+		body["data"] = nucleoError.Data
+	}
+	return body
+}
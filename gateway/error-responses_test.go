@@ -0,0 +1,25 @@
+package gateway
+
+import "testing"
+
+func TestPlainErrorType(t *testing.T) {
+	tests := []struct {
+		message  string
+		expected string
+	}{
+		{"Registry - endpoint not found for actionName: math.add", "SERVICE_NOT_FOUND"},
+		{"request timeout", "REQUEST_TIMEOUT"},
+		{"Node node-1 disconnected. The request was canceled.", "SERVICE_NOT_AVAILABLE"},
+		{"can't complete request! registry stopping...", "SERVICE_NOT_AVAILABLE"},
+		{"session timeout", "INTERNAL_ERROR"},
+		{"user disconnected", "INTERNAL_ERROR"},
+		{"order endpoint not found", "INTERNAL_ERROR"},
+		{"boom", "INTERNAL_ERROR"},
+	}
+
+	for _, test := range tests {
+		if errorType := plainErrorType(test.message); errorType != test.expected {
+			t.Errorf("plainErrorType(%q) = %s, expected %s", test.message, errorType, test.expected)
+		}
+	}
+}
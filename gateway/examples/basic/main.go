@@ -41,17 +41,29 @@ var Calculator = nucleo.ServiceSchema{
 		},
 	},
 }
-var authenticateHandler = func(context nucleo.Context, ginContext *gin.Context, alias string) interface{} {
+var authenticateHandler = func(context nucleo.Context, ginContext *gin.Context, alias string) (interface{}, error) {
 	fmt.Println("authenticate called")
 
+	token := ginContext.GetHeader("Authorization")
+	if token == "" {
+		// rejects the request with a 401
+		return nil, errors.New("missing token")
+	}
+
 	return map[string]interface{}{
 		"name":  "Benjamin",
-		"token": "ds.kljvbajh akjsbfkhas fjnas",
-	}
+		"token": token,
+	}, nil
 }
 
-var authorizeHandler = func(context nucleo.Context, ginContext *gin.Context, alias string) {
+var authorizeHandler = func(context nucleo.Context, ginContext *gin.Context, alias string) error {
 	fmt.Println("authorize called")
+
+	if alias == "" {
+		// rejects the request with a 403
+		return errors.New("only the aliases can be called")
+	}
+	return nil
 }
 
 var GatewayMixin = gateway.NewGatewayMixin(gateway.GatewayMixin{
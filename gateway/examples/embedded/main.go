@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Bendomey/awesome-nucleo/gateway"
+	"github.com/Bendomey/nucleo-go"
+	"github.com/Bendomey/nucleo-go/broker"
+	"github.com/gin-gonic/gin"
+)
+
+var Calculator = nucleo.ServiceSchema{
+	Name:     "calculator",
+	Settings: map[string]interface{}{},
+	Actions: []nucleo.Action{
+		{
+			Name:        "hello",
+			Description: "print hello world",
+			Handler: func(ctx nucleo.Context, params nucleo.Payload) interface{} {
+				return "hello world"
+			},
+		},
+	},
+}
+
+var Gateway = gateway.NewGatewayService(gateway.GatewayMixin{})
+
+var GatewayApi = nucleo.ServiceSchema{
+	Name: "gateway",
+	Mixins: []nucleo.Mixin{
+		Gateway.Mixin(),
+	},
+	Settings: map[string]interface{}{
+		// the gateway is served by our own server
+		"server": false,
+	},
+}
+
+func main() {
+	bkr := broker.New(&nucleo.Config{LogLevel: nucleo.LogLevelDebug})
+
+	bkr.PublishServices(GatewayApi, Calculator)
+
+	bkr.Start()
+
+	// our existing server, with the gateway mounted under /api (e.g. GET /api/calculator/hello)
+	router := gin.Default()
+	router.GET("/status", func(ginContext *gin.Context) {
+		ginContext.String(http.StatusOK, "ok")
+	})
+	Gateway.Mount(router.Group("/api"))
+
+	// or with net/http:
+	// http.Handle("/api/", http.StripPrefix("/api", Gateway.Handler()))
+
+	server := &http.Server{Addr: ":5002", Handler: router}
+	go server.ListenAndServe()
+
+	signalC := make(chan os.Signal, 1)
+	signal.Notify(signalC, os.Interrupt, syscall.SIGTERM)
+
+	<-signalC
+
+	server.Close()
+	bkr.Stop()
+}
@@ -1,10 +1,10 @@
 package gateway
 
 import (
-	goContext "context"
 	"fmt"
 	"net/http"
-	"time"
+	"sort"
+	"strings"
 
 	"github.com/Bendomey/nucleo-go"
 	"github.com/Bendomey/nucleo-go/service"
@@ -12,16 +12,27 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-type AuthenticateMethodsFunc = func(context nucleo.Context, ginContext *gin.Context, alias string) interface{}
-type AuthorizeMethodFunc = func(context nucleo.Context, ginContext *gin.Context, alias string)
+// AuthenticateMethodsFunc returns the user of the request, set in the "user" meta (nil for anonymous users).
+// Returning an error rejects the request with a 401.
+type AuthenticateMethodsFunc = func(context nucleo.Context, ginContext *gin.Context, alias string) (interface{}, error)
+
+// AuthorizeMethodFunc checks the user can call the alias. Returning an error rejects the request with a 403.
+type AuthorizeMethodFunc = func(context nucleo.Context, ginContext *gin.Context, alias string) error
 
 type GatewayService struct {
-	Authenticate  *AuthenticateMethodsFunc
-	Authorize     *AuthorizeMethodFunc
-	settings      map[string]interface{}
-	mainRouter    *gin.Engine
-	gatewayRouter *gin.RouterGroup
-	server        *http.Server
+	Authenticate *AuthenticateMethodsFunc
+	Authorize    *AuthorizeMethodFunc
+	settings     map[string]interface{}
+	routes       *routeTable
+	servers      []*gatewayServer
+	readiness    *readinessProbe
+	inFlight     *inFlightCalls
+	stopping     chan struct{}
+	created      chan struct{}
+	settingsErr  error
+
+	// context the gateway was started with, used to build the routes and call the actions.
+	context nucleo.BrokerContext
 }
 
 type GatewayMixin struct {
@@ -30,19 +41,56 @@ type GatewayMixin struct {
 }
 
 func NewGatewayMixin(start GatewayMixin) nucleo.Mixin {
-	gatewayMixin := GatewayService{
+	return NewGatewayService(start).Mixin()
+}
+
+// NewGatewayService creates the gateway service. Use it instead of NewGatewayMixin to
+// embed the gateway in an existing http server with Handler or Mount.
+func NewGatewayService(start GatewayMixin) *GatewayService {
+	return &GatewayService{
 		Authenticate: start.Authenticate,
 		Authorize:    start.Authorize,
+		routes:       &routeTable{},
+		readiness:    &readinessProbe{},
+		inFlight:     newInFlightCalls(),
+		created:      make(chan struct{}),
 	}
+}
 
+// Mixin returns the mixin to add to your service schema.
+func (svc *GatewayService) Mixin() nucleo.Mixin {
 	return nucleo.Mixin{
-		Name:         gatewayMixin.Name(),
-		Dependencies: gatewayMixin.Dependencies(),
-		Settings:     gatewayMixin.settings,
-		Metadata:     gatewayMixin.Metadata(),
-		Created:      gatewayMixin.Created,
-		Started:      gatewayMixin.Started,
-		Stopped:      gatewayMixin.Stopped,
+		Name:         svc.Name(),
+		Dependencies: svc.Dependencies(),
+		Settings:     svc.settings,
+		Metadata:     svc.Metadata(),
+		Created:      svc.Created,
+		Started:      svc.Started,
+		Stopped:      svc.Stopped,
+	}
+}
+
+// Handler returns the gateway as an http.Handler, with all the routes, hooks and middlewares.
+// It answers 503 until the gateway service is started.
+func (svc *GatewayService) Handler() http.Handler {
+	return http.HandlerFunc(svc.serveHTTP)
+}
+
+// Mount serves the gateway from an existing gin engine or router group.
+// On a router group, the gateway routes are relative to the group path.
+// On an engine, the gateway serves the paths the engine does not handle itself.
+func (svc *GatewayService) Mount(router gin.IRouter) {
+	switch router := router.(type) {
+	case *gin.Engine:
+		router.NoRoute(gin.WrapH(svc.Handler()))
+	case *gin.RouterGroup:
+		handler := svc.Handler()
+		if basePath := strings.TrimSuffix(router.BasePath(), "/"); basePath != "" {
+			handler = http.StripPrefix(basePath, handler)
+		}
+		router.Any("/*gatewayPath", gin.WrapH(handler))
+	default:
+		panic(fmt.Sprintf("gateway can't be mounted on %T", router))
 	}
 }
 
@@ -70,69 +118,89 @@ func (svc *GatewayService) Metadata() map[string]interface{} {
 func (svc *GatewayService) Created(schema nucleo.ServiceSchema, logger *log.Entry) {
 	// Merge user defined settings with our default settings
 	svc.settings = service.MergeSettings(defaultSettings, schema.Settings, svc.settings)
+
+	// bad settings are reported all at once when starting, instead of panicking later while serving.
+	svc.settingsErr = svc.validateSettings()
+	close(svc.created)
 }
 
 func (svc *GatewayService) Started(context nucleo.BrokerContext, schema nucleo.ServiceSchema) {
-	// create gin server
-	svc.mainRouter = gin.Default()
-
-	address := svc.getAddress()
-	svc.server = &http.Server{
-		Addr:    address,
-		Handler: svc.mainRouter,
-		// TODO: setup Https support
-	}
+	// nucleo calls Created in its own goroutine, make sure the settings are merged.
+	<-svc.created
 
-	// register all global middlewares
-	svc.registerGlobalMiddlewares()
+	// the broker can't be told the service failed, fail loudly instead of running without a gateway.
+	if svc.settingsErr != nil {
+		context.Logger().Errorln("Gateway not started - ", svc.settingsErr)
+		panic(svc.settingsErr)
+	}
 
-	// we have a global path that user's can set their gateways up with.
-	svc.registerBaseGatewayPath()
+	// one server per listener, all sharing the same route table
+	servers, err := svc.createServers(http.HandlerFunc(svc.serveHTTP), context.Logger())
+	if err != nil {
+		context.Logger().Errorln("Could not setup the gateway listeners - error: ", err)
+		return
+	}
+	svc.servers = servers
+	svc.context = context
+	svc.stopping = make(chan struct{})
 
-	go svc.startServer(context)
-	go svc.registerActionsRouter(context.(nucleo.Context))
+	// the routes are built from the registry, without blocking the broker start.
+	go svc.startWhenRoutesAreReady(context)
 	context.Logger().Infoln("Gateway Started()")
 }
 
 func (svc *GatewayService) Stopped(context nucleo.BrokerContext, service nucleo.ServiceSchema) {
-	if svc.server != nil {
-		ctx, cancel := goContext.WithTimeout(goContext.Background(), 5*time.Second)
-		defer cancel()
-
-		if err := svc.server.Shutdown(ctx); err != nil {
-			context.Logger().Errorln("Error shutting down server - error: ", err)
-		}
-
+	if svc.stopping != nil {
+		close(svc.stopping)
 	}
+	svc.stopWatchingRoutes()
+	svc.drain(context)
 }
 
 // registerActionsRouter registers all exposed permitted actions/aliases as REST endpoints.
-func (svc *GatewayService) registerActionsRouter(context nucleo.Context) {
-	// make sure we have a router
-	if svc.gatewayRouter == nil {
-		return
+// The aliases are registered first: the path generated for an action (mapping policy all) that conflicts
+// with an alias, e.g. /api/users/list next to the catch-all alias /api/*path, is skipped instead of failing the build.
+func (svc *GatewayService) registerActionsRouter(context nucleo.Context, gatewayRouter *gin.RouterGroup, services []map[string]interface{}) {
+	actionHandlers := svc.getPermittedActionsAndThenCreateEndpoints(context, gatewayRouter, services)
+	sort.SliceStable(actionHandlers, func(i, j int) bool {
+		return actionHandlers[i].alias != "" && actionHandlers[j].alias == ""
+	})
+
+	// method -> endpoints registered for it, the aliases conflicts were reported by the settings validation.
+	endpoints := map[string][]endpoint{}
+	if readinessPath, _ := svc.settings["readinessPath"].(string); readinessPath != "" {
+		endpoints[http.MethodGet] = append(endpoints[http.MethodGet], endpoint{readinessPath, "readinessPath"})
 	}
 
-	for _, actionHandler := range svc.getPermittedActionsAndThenCreateEndpoints(context, fetchServices(context)) {
+	for _, actionHandler := range actionHandlers {
 		actionHandler.context = context
 		actionHandler.settings = svc.settings
+		actionHandler.inFlight = svc.inFlight
 
 		path := actionHandler.getFullPath()
+		fullPath := joinPaths(actionHandler.router.BasePath(), path)
 		context.Logger().Traceln("registerActionsRouter() action -> ", actionHandler.action, " path: ", path)
 
 		methods := actionHandler.AcceptedMethods()
 
 		// loop over methods
 		for method, shouldRegisterMethod := range methods {
-			if shouldRegisterMethod {
-				actionHandler.router.Handle(method, path, actionHandler.Handler())
+			if !shouldRegisterMethod {
+				continue
+			}
+			if conflict := conflictingEndpoint(endpoints[method], fullPath); conflict != nil && actionHandler.alias == "" {
+				context.Logger().Errorln("Gateway skipped the path of action ", actionHandler.action, " - ", method, " ", fullPath,
+					" conflicts with ", method, " ", conflict.path, " of ", conflict.owner, ", use the mapping policy restrict on this route")
+				continue
 			}
+			endpoints[method] = append(endpoints[method], endpoint{fullPath, actionHandler.endpointOwner()})
+			actionHandler.router.Handle(method, path, actionHandler.Handler())
 		}
 	}
 
 }
 
-func (svc *GatewayService) getPermittedActionsAndThenCreateEndpoints(context nucleo.Context, services []map[string]interface{}) []*actionHandler {
+func (svc *GatewayService) getPermittedActionsAndThenCreateEndpoints(context nucleo.Context, gatewayRouter *gin.RouterGroup, services []map[string]interface{}) []*actionHandler {
 	actionHandlers := []*actionHandler{}
 
 	// get the list of routes
@@ -140,6 +208,7 @@ func (svc *GatewayService) getPermittedActionsAndThenCreateEndpoints(context nuc
 
 	for _, route := range routes {
 		filteredActions := []string{}
+		paramsSchemas := map[string]map[string]interface{}{}
 
 		settingsWhiteList := route.Whitelist
 		whitelist := []string{"**"}
@@ -153,6 +222,7 @@ func (svc *GatewayService) getPermittedActionsAndThenCreateEndpoints(context nuc
 				actionName := action["name"].(string)
 				if shouldIncludeAction(whitelist, actionName) {
 					filteredActions = append(filteredActions, actionName)
+					paramsSchemas[actionName], _ = action["params"].(map[string]interface{})
 				}
 			}
 		}
@@ -169,13 +239,13 @@ func (svc *GatewayService) getPermittedActionsAndThenCreateEndpoints(context nuc
 		}
 
 		// create a route
-		newRouterGroup := svc.gatewayRouter.Group(routePath)
+		newRouterGroup := gatewayRouter.Group(routePath)
 
 		//register middlewares
 		newRouterGroup.Use(middlewares...)
 
 		// now that we have the permitted actions, we gotta create the REST endpoints
-		actionHandlers = append(actionHandlers, createActionHandlers(route, filteredActions, newRouterGroup, svc.Authenticate, svc.Authorize)...)
+		actionHandlers = append(actionHandlers, createActionHandlers(route, filteredActions, paramsSchemas, newRouterGroup, svc.Authenticate, svc.Authorize)...)
 	}
 
 	return actionHandlers
@@ -187,34 +257,41 @@ func (svc *GatewayService) getAddress() string {
 	return fmt.Sprint(ip, ":", port)
 }
 
-func (svc *GatewayService) startServer(context nucleo.BrokerContext) {
-	address := svc.getAddress()
-	context.Logger().Infoln("Server starting to listen on: ", address)
+func (svc *GatewayService) startServer(context nucleo.BrokerContext, server *gatewayServer) {
+	context.Logger().Infoln("Server starting to listen on: ", server.listener)
+
+	if server.http3Server != nil {
+		go func() {
+			if err := server.serveHttp3(); err != nil && err != http.ErrServerClosed {
+				context.Logger().Errorln("Error listening http3 server on: ", server.listener, " error: ", err)
+			}
+		}()
+	}
 
-	if err := svc.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		context.Logger().Errorln("Error listening server on: ", address, " error: ", err)
+	if err := server.serve(); err != nil && err != http.ErrServerClosed {
+		context.Logger().Errorln("Error listening server on: ", server.listener, " error: ", err)
 		return
 	}
 
-	context.Logger().Infoln("Server started on: ", address)
+	context.Logger().Infoln("Server stopped on: ", server.listener)
 }
 
-func (svc *GatewayService) registerGlobalMiddlewares() {
+func (svc *GatewayService) registerGlobalMiddlewares(mainRouter *gin.Engine) {
 
 	middlewaresSettings, exists := svc.settings["use"].([]gin.HandlerFunc)
 	middlewares := []gin.HandlerFunc{}
 	if exists {
 		middlewares = middlewaresSettings
 	}
-	svc.mainRouter.Use(middlewares...)
+	mainRouter.Use(middlewares...)
 }
 
-func (svc *GatewayService) registerBaseGatewayPath() {
+func (svc *GatewayService) registerBaseGatewayPath(mainRouter *gin.Engine) *gin.RouterGroup {
 
 	basePath, exists := svc.settings["path"].(string)
 	path := "/"
 	if exists {
 		path = basePath
 	}
-	svc.gatewayRouter = svc.mainRouter.Group(path)
+	return mainRouter.Group(path)
 }
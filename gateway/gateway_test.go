@@ -0,0 +1,77 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Bendomey/nucleo-go"
+	"github.com/Bendomey/nucleo-go/broker"
+	"github.com/gin-gonic/gin"
+)
+
+// startGateway starts a broker with the services and the gateway, embedded without listeners,
+// and returns the gateway handler once its routes are built.
+func startGateway(t *testing.T, mixin GatewayMixin, settings map[string]interface{}, services ...nucleo.ServiceSchema) http.Handler {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	gateway := NewGatewayService(mixin)
+	settings["server"] = false
+	api := nucleo.ServiceSchema{
+		Name:     "api",
+		Mixins:   []nucleo.Mixin{gateway.Mixin()},
+		Settings: settings,
+	}
+
+	bkr := broker.New(&nucleo.Config{LogLevel: nucleo.LogLevelError})
+	for _, service := range services {
+		bkr.PublishServices(service)
+	}
+	bkr.PublishServices(api)
+	bkr.Start()
+	t.Cleanup(bkr.Stop)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for gateway.routes.router.Load() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("the gateway routes were not built")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return gateway.Handler()
+}
+
+func TestActionPathsConflictingWithAliases(t *testing.T) {
+	action := func(result string) nucleo.Action {
+		return nucleo.Action{Name: result, Handler: func(context nucleo.Context, params nucleo.Payload) interface{} {
+			return result
+		}}
+	}
+	users := nucleo.ServiceSchema{Name: "users", Actions: []nucleo.Action{action("list")}}
+	files := nucleo.ServiceSchema{Name: "files", Actions: []nucleo.Action{action("get"), action("remove")}}
+
+	// the catch-all alias conflicts with the path generated for users.list, which is skipped.
+	handler := startGateway(t, GatewayMixin{}, map[string]interface{}{
+		"routes": []Route{{Path: "/api", Aliases: map[string]string{"GET /users/*path": "files.get"}}},
+	}, users, files)
+
+	tests := []struct {
+		path       string
+		statusCode int
+		body       string
+	}{
+		{"/api/users/avatar.png", http.StatusOK, "get"},
+		{"/api/users/list", http.StatusOK, "get"},
+		{"/api/files/remove", http.StatusOK, "remove"},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if recorder.Code != test.statusCode || recorder.Body.String() != test.body {
+			t.Errorf("%s: %d %s, expected %d %s", test.path, recorder.Code, recorder.Body.String(), test.statusCode, test.body)
+		}
+	}
+}
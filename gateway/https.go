@@ -0,0 +1,282 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type ClientAuthType string
+
+const (
+	// ClientAuthRequire rejects TLS handshakes without a valid client certificate.
+	ClientAuthRequire ClientAuthType = "require"
+
+	// ClientAuthVerifyIfGiven accepts clients without certificates, but verifies the ones that send one.
+	ClientAuthVerifyIfGiven ClientAuthType = "verifyIfGiven"
+)
+
+type ClientAuthSettings struct {
+	// Path to the PEM encoded CA bundle used to verify client certificates.
+	CAFile string
+
+	// In-memory PEM encoded CA bundle. Used when CAFile is empty.
+	CA []byte
+
+	// Mode -> require : a verified client certificate is mandatory.
+	// Mode -> verifyIfGiven : client certificates are optional but verified when given.
+	Mode ClientAuthType
+}
+
+type HttpsSettings struct {
+	// Path to the PEM encoded certificate (chain) on disk.
+	CertFile string
+
+	// Path to the PEM encoded private key on disk.
+	KeyFile string
+
+	// In-memory PEM encoded certificate. Used when CertFile is empty.
+	Cert []byte
+
+	// In-memory PEM encoded private key. Used when KeyFile is empty.
+	Key []byte
+
+	// Minimum TLS version accepted (defaults to tls.VersionTLS12).
+	MinVersion uint16
+
+	// Cipher suites accepted for TLS 1.0 - 1.2. Go's defaults are used when empty.
+	CipherSuites []uint16
+
+	// Mutual TLS settings. Client certificates are not requested when nil.
+	ClientAuth *ClientAuthSettings
+
+	// How often the cert/key files are checked for changes (defaults to 30 seconds).
+	// A negative value turns off automatic reloading.
+	ReloadInterval time.Duration
+}
+
+var defaultCertReloadInterval = 30 * time.Second
+
+// certificateLoader keeps the gateway certificate in memory and reloads it
+// from disk when the cert/key files change, so certificates can be rotated without a restart.
+type certificateLoader struct {
+	certFile       string
+	keyFile        string
+	reloadInterval time.Duration
+	logger         *log.Entry
+
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	modTime     time.Time
+	lastCheck   time.Time
+}
+
+func newCertificateLoader(settings *HttpsSettings, logger *log.Entry) (*certificateLoader, error) {
+	loader := &certificateLoader{
+		certFile:       settings.CertFile,
+		keyFile:        settings.KeyFile,
+		reloadInterval: settings.ReloadInterval,
+		logger:         logger,
+	}
+
+	if loader.reloadInterval == 0 {
+		loader.reloadInterval = defaultCertReloadInterval
+	}
+
+	if settings.CertFile == "" && settings.KeyFile == "" {
+		if len(settings.Cert) == 0 || len(settings.Key) == 0 {
+			return nil, errors.New("https settings needs either CertFile/KeyFile or Cert/Key")
+		}
+		certificate, err := tls.X509KeyPair(settings.Cert, settings.Key)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse in-memory certificate: %w", err)
+		}
+		loader.certificate = &certificate
+		return loader, nil
+	}
+
+	if settings.CertFile == "" || settings.KeyFile == "" {
+		return nil, errors.New("https settings needs both CertFile and KeyFile")
+	}
+
+	if err := loader.load(); err != nil {
+		return nil, err
+	}
+
+	return loader, nil
+}
+
+// fromFiles returns true when the certificate is backed by files on disk.
+func (loader *certificateLoader) fromFiles() bool {
+	return loader.certFile != ""
+}
+
+// filesModTime returns the latest modification time of the cert and key files.
+func (loader *certificateLoader) filesModTime() (time.Time, error) {
+	certInfo, err := os.Stat(loader.certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	keyInfo, err := os.Stat(loader.keyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if keyInfo.ModTime().After(certInfo.ModTime()) {
+		return keyInfo.ModTime(), nil
+	}
+	return certInfo.ModTime(), nil
+}
+
+func (loader *certificateLoader) load() error {
+	modTime, err := loader.filesModTime()
+	if err != nil {
+		return fmt.Errorf("could not read certificate files: %w", err)
+	}
+
+	certificate, err := tls.LoadX509KeyPair(loader.certFile, loader.keyFile)
+	if err != nil {
+		return fmt.Errorf("could not load certificate: %w", err)
+	}
+
+	loader.certificate = &certificate
+	loader.modTime = modTime
+	loader.lastCheck = time.Now()
+	return nil
+}
+
+// reloadIfChanged reloads the certificate when the files were modified since the last load.
+// The files are checked at most once per reloadInterval.
+func (loader *certificateLoader) reloadIfChanged() {
+	if !loader.fromFiles() || loader.reloadInterval < 0 || time.Since(loader.lastCheck) < loader.reloadInterval {
+		return
+	}
+	loader.lastCheck = time.Now()
+
+	modTime, err := loader.filesModTime()
+	if err != nil {
+		loader.logger.Errorln("Could not check certificate files for changes - error: ", err)
+		return
+	}
+	if !modTime.After(loader.modTime) {
+		return
+	}
+
+	// keep serving the previous certificate if the new one is broken (e.g. half written files)
+	if err := loader.load(); err != nil {
+		loader.logger.Errorln("Could not reload certificate, keeping the previous one - error: ", err)
+		return
+	}
+	loader.logger.Infoln("Certificate reloaded from: ", loader.certFile)
+}
+
+// GetCertificate is used as tls.Config.GetCertificate.
+func (loader *certificateLoader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	loader.mutex.Lock()
+	defer loader.mutex.Unlock()
+
+	loader.reloadIfChanged()
+	return loader.certificate, nil
+}
+
+// createTLSConfig creates the tls config used by the gateway server from the https settings.
+func createTLSConfig(settings *HttpsSettings, logger *log.Entry) (*tls.Config, error) {
+	loader, err := newCertificateLoader(settings, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	minVersion := settings.MinVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   settings.CipherSuites,
+		GetCertificate: loader.GetCertificate,
+	}
+
+	if settings.ClientAuth != nil {
+		if err := setupClientAuth(tlsConfig, settings.ClientAuth); err != nil {
+			return nil, err
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// setupClientAuth configures the tls config to request and verify client certificates.
+func setupClientAuth(tlsConfig *tls.Config, settings *ClientAuthSettings) error {
+	ca := settings.CA
+	if settings.CAFile != "" {
+		caFromFile, err := os.ReadFile(settings.CAFile)
+		if err != nil {
+			return fmt.Errorf("could not read client CA bundle: %w", err)
+		}
+		ca = caFromFile
+	}
+
+	if len(ca) == 0 {
+		return errors.New("client auth settings needs either CAFile or CA")
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return errors.New("client CA bundle does not contain any valid PEM certificate")
+	}
+	tlsConfig.ClientCAs = pool
+
+	switch settings.Mode {
+	case ClientAuthRequire, "":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	case ClientAuthVerifyIfGiven:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return fmt.Errorf("invalid client auth mode -> %s", settings.Mode)
+	}
+
+	return nil
+}
+
+// clientCertificateInfo returns the identity of the verified peer certificate, if the client sent one.
+func clientCertificateInfo(state *tls.ConnectionState) map[string]interface{} {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	certificate := state.VerifiedChains[0][0]
+	fingerprint := sha256.Sum256(certificate.Raw)
+
+	ipAddresses := []string{}
+	for _, ip := range certificate.IPAddresses {
+		ipAddresses = append(ipAddresses, ip.String())
+	}
+
+	uris := []string{}
+	for _, uri := range certificate.URIs {
+		uris = append(uris, uri.String())
+	}
+
+	return map[string]interface{}{
+		"subject":      certificate.Subject.String(),
+		"commonName":   certificate.Subject.CommonName,
+		"issuer":       certificate.Issuer.String(),
+		"serialNumber": certificate.SerialNumber.String(),
+		"fingerprint":  hex.EncodeToString(fingerprint[:]),
+		"sans": map[string]interface{}{
+			"dns":    certificate.DNSNames,
+			"emails": certificate.EmailAddresses,
+			"ips":    ipAddresses,
+			"uris":   uris,
+		},
+	}
+}
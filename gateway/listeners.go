@@ -0,0 +1,393 @@
+package gateway
+
+import (
+	goContext "context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
+)
+
+type NetworkType string
+
+const (
+	NetworkTCP  NetworkType = "tcp"
+	NetworkUnix NetworkType = "unix"
+)
+
+type Listener struct {
+	// Name of the listener, used in logs.
+	Name string
+
+	// Network -> tcp : Address is a "host:port" pair. This is the default.
+	// Network -> unix : Address is the path of a unix domain socket.
+	Network NetworkType
+
+	// Address the listener binds to.
+	Address string
+
+	// Https settings of the listener. The listener serves plain http when nil.
+	Https *HttpsSettings
+
+	// When true, the listener does not serve the gateway and redirects every
+	// request to the first https listener instead.
+	RedirectToHttps bool
+
+	// Status code used for redirects. Either 301 (default) or 308.
+	RedirectStatusCode int
+
+	// Accept HTTP/2 over cleartext (h2c) on a plain http listener, e.g. behind a load balancer.
+	// Https listeners negotiate HTTP/2 on their own.
+	H2C bool
+
+	// Also serve HTTP/3 (QUIC) on the same address over udp, advertised with the Alt-Svc header.
+	// Only available on https tcp listeners.
+	HTTP3 bool
+}
+
+// gatewayServer is a running http server bound to one of the listeners.
+type gatewayServer struct {
+	listener       Listener
+	server         *http.Server
+	http3Server    *http3.Server
+	maxConnections int
+
+	// bound by bind, before serving.
+	netListener  net.Listener
+	quicListener http3.QUICEarlyListener
+
+	// http3 requests being served, waited for when draining.
+	http3Requests atomic.Int64
+}
+
+// getListeners returns the listeners from the settings, or a single listener
+// built from the ip/port/https settings when none are configured.
+func (svc *GatewayService) getListeners() []Listener {
+	listeners, exists := svc.settings["listeners"].([]Listener)
+	if exists && len(listeners) > 0 {
+		return listeners
+	}
+
+	httpsSettings, _ := svc.settings["https"].(*HttpsSettings)
+	return []Listener{
+		{
+			Name:    "default",
+			Network: NetworkTCP,
+			Address: svc.getAddress(),
+			Https:   httpsSettings,
+		},
+	}
+}
+
+// createServers creates one http server per listener, all sharing the same handler.
+func (svc *GatewayService) createServers(handler http.Handler, logger *log.Entry) ([]*gatewayServer, error) {
+	servers := []*gatewayServer{}
+
+	// the gateway is embedded in an existing http server
+	if server, exists := svc.settings["server"].(bool); exists && !server {
+		return servers, nil
+	}
+
+	listeners := svc.getListeners()
+
+	for _, listener := range listeners {
+		if listener.Network == "" {
+			listener.Network = NetworkTCP
+		}
+
+		server := &http.Server{
+			Handler:           handler,
+			ReadTimeout:       svc.durationSetting("readTimeout"),
+			ReadHeaderTimeout: svc.durationSetting("readHeaderTimeout"),
+			WriteTimeout:      svc.durationSetting("writeTimeout"),
+			IdleTimeout:       svc.durationSetting("idleTimeout"),
+			MaxHeaderBytes:    svc.intSetting("maxHeaderBytes"),
+		}
+
+		if listener.Https != nil {
+			tlsConfig, err := createTLSConfig(listener.Https, logger)
+			if err != nil {
+				return nil, fmt.Errorf("listener %s: %w", listener.Name, err)
+			}
+			server.TLSConfig = tlsConfig
+		}
+
+		if listener.H2C {
+			if listener.Https != nil {
+				return nil, fmt.Errorf("listener %s: h2c is only available on plain http listeners", listener.Name)
+			}
+			server.Handler = h2c.NewHandler(handler, &http2.Server{})
+		}
+
+		listenerServer := &gatewayServer{
+			listener:       listener,
+			server:         server,
+			maxConnections: svc.intSetting("maxConnections"),
+		}
+
+		if listener.HTTP3 {
+			if listener.Https == nil || listener.Network != NetworkTCP {
+				return nil, fmt.Errorf("listener %s: http3 is only available on https tcp listeners", listener.Name)
+			}
+			listenerServer.http3Server = &http3.Server{
+				Addr:           listener.Address,
+				Handler:        listenerServer.http3Handler(handler, server.ReadTimeout, server.WriteTimeout),
+				TLSConfig:      http3.ConfigureTLSConfig(server.TLSConfig),
+				MaxHeaderBytes: server.MaxHeaderBytes,
+				// 0RTT is what quic-go allows when no config is given.
+				QuicConfig: &quic.Config{Allow0RTT: true, MaxIdleTimeout: server.IdleTimeout},
+			}
+			server.Handler = altSvcHandler(listenerServer.http3Server, handler)
+		}
+
+		if listener.RedirectToHttps {
+			redirectHandler, err := createHttpsRedirectHandler(listeners, listener.RedirectStatusCode)
+			if err != nil {
+				return nil, fmt.Errorf("listener %s: %w", listener.Name, err)
+			}
+			server.Handler = redirectHandler
+		}
+
+		servers = append(servers, listenerServer)
+	}
+
+	return servers, nil
+}
+
+// listen binds the listener address. Stale unix sockets left by a previous run are removed first,
+// anything else at the socket path is left untouched and the listener fails.
+func (gatewayServer *gatewayServer) listen() (net.Listener, error) {
+	if gatewayServer.listener.Network == NetworkUnix {
+		info, err := os.Lstat(gatewayServer.listener.Address)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil && info.Mode()&os.ModeSocket != 0 {
+			if err := os.Remove(gatewayServer.listener.Address); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+	}
+
+	netListener, err := net.Listen(string(gatewayServer.listener.Network), gatewayServer.listener.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	// connections above the limit wait in the accept queue until a slot is free.
+	if gatewayServer.maxConnections > 0 {
+		netListener = netutil.LimitListener(netListener, gatewayServer.maxConnections)
+	}
+	return netListener, nil
+}
+
+// bind binds the listener address, and the udp address of the http3 server.
+func (gatewayServer *gatewayServer) bind() error {
+	netListener, err := gatewayServer.listen()
+	if err != nil {
+		return err
+	}
+
+	if gatewayServer.http3Server != nil {
+		quicListener, err := gatewayServer.listenHttp3()
+		if err != nil {
+			netListener.Close()
+			return err
+		}
+		gatewayServer.quicListener = quicListener
+	}
+	gatewayServer.netListener = netListener
+	return nil
+}
+
+// serve accepts connections on the bound listener until the server is shut down.
+func (gatewayServer *gatewayServer) serve() error {
+	if gatewayServer.server.TLSConfig != nil {
+		// certificates are served from the tls config, so no files are passed here.
+		return gatewayServer.server.ServeTLS(gatewayServer.netListener, "", "")
+	}
+	return gatewayServer.server.Serve(gatewayServer.netListener)
+}
+
+// serveHttp3 accepts QUIC connections on the bound udp address until the server is closed.
+func (gatewayServer *gatewayServer) serveHttp3() error {
+	return gatewayServer.http3Server.ServeListener(gatewayServer.quicListener)
+}
+
+// listenHttp3 binds the udp address of the http3 server, with the same connections limit as the tcp listener.
+func (gatewayServer *gatewayServer) listenHttp3() (http3.QUICEarlyListener, error) {
+	http3Server := gatewayServer.http3Server
+	quicListener, err := quic.ListenAddrEarly(http3Server.Addr, http3Server.TLSConfig, http3Server.QuicConfig)
+	if err != nil {
+		return nil, err
+	}
+	if gatewayServer.maxConnections > 0 {
+		return newLimitQuicListener(quicListener, gatewayServer.maxConnections), nil
+	}
+	return quicListener, nil
+}
+
+// http3Handler applies the read and write timeouts to each http3 request, quic-go has no server wide
+// timeouts, and counts the requests being served.
+func (gatewayServer *gatewayServer) http3Handler(handler http.Handler, readTimeout, writeTimeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		gatewayServer.http3Requests.Add(1)
+		defer gatewayServer.http3Requests.Add(-1)
+
+		controller := http.NewResponseController(writer)
+		if readTimeout > 0 {
+			_ = controller.SetReadDeadline(time.Now().Add(readTimeout))
+		}
+		if writeTimeout > 0 {
+			_ = controller.SetWriteDeadline(time.Now().Add(writeTimeout))
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// waitForHttp3Requests waits until the http3 requests are served or the context is done.
+// quic-go has no graceful shutdown, closing the http3 server aborts the requests being served.
+func (gatewayServer *gatewayServer) waitForHttp3Requests(ctx goContext.Context) {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for gatewayServer.http3Requests.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// limitQuicListener accepts at most maxConnections connections at once, the others wait
+// in the accept queue until a slot is free, like the tcp listener.
+type limitQuicListener struct {
+	http3.QUICEarlyListener
+	slots     chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newLimitQuicListener(quicListener http3.QUICEarlyListener, maxConnections int) *limitQuicListener {
+	return &limitQuicListener{
+		QUICEarlyListener: quicListener,
+		slots:             make(chan struct{}, maxConnections),
+		done:              make(chan struct{}),
+	}
+}
+
+func (listener *limitQuicListener) Accept(ctx goContext.Context) (quic.EarlyConnection, error) {
+	select {
+	case listener.slots <- struct{}{}:
+	case <-listener.done:
+		return nil, quic.ErrServerClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	connection, err := listener.QUICEarlyListener.Accept(ctx)
+	if err != nil {
+		<-listener.slots
+		return nil, err
+	}
+
+	// the slot is free once the connection is closed.
+	go func() {
+		<-connection.Context().Done()
+		<-listener.slots
+	}()
+	return connection, nil
+}
+
+func (listener *limitQuicListener) Close() error {
+	listener.closeOnce.Do(func() { close(listener.done) })
+	return listener.QUICEarlyListener.Close()
+}
+
+// altSvcHandler advertises the http3 server to clients connecting over tcp.
+func altSvcHandler(http3Server *http3.Server, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		// fails only while the udp socket is not listening yet, then there is nothing to advertise.
+		_ = http3Server.SetQuicHeaders(writer.Header())
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// durationSetting returns a time.Duration setting, or 0 when it is not set.
+func (svc *GatewayService) durationSetting(name string) time.Duration {
+	value, _ := svc.settings[name].(time.Duration)
+	return value
+}
+
+// intSetting returns an int setting, or 0 when it is not set.
+func (svc *GatewayService) intSetting(name string) int {
+	value, _ := svc.settings[name].(int)
+	return value
+}
+
+// createHttpsRedirectHandler returns a handler redirecting requests to the first https tcp listener.
+func createHttpsRedirectHandler(listeners []Listener, statusCode int) (http.Handler, error) {
+	if statusCode == 0 {
+		statusCode = http.StatusMovedPermanently
+	}
+	if statusCode != http.StatusMovedPermanently && statusCode != http.StatusPermanentRedirect {
+		return nil, fmt.Errorf("invalid redirect status code -> %d", statusCode)
+	}
+
+	httpsPort := ""
+	for _, listener := range listeners {
+		if listener.Https != nil && !listener.RedirectToHttps && (listener.Network == "" || listener.Network == NetworkTCP) {
+			_, port, err := net.SplitHostPort(listener.Address)
+			if err != nil {
+				return nil, err
+			}
+			httpsPort = port
+			break
+		}
+	}
+
+	if httpsPort == "" {
+		return nil, errors.New("redirect to https needs an https tcp listener")
+	}
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		host, _, err := net.SplitHostPort(request.Host)
+		if err != nil {
+			// no port in the host header
+			host = request.Host
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		target := fmt.Sprint("https://", host, request.URL.RequestURI())
+		http.Redirect(writer, request, target, statusCode)
+	}), nil
+}
+
+func (listener Listener) String() string {
+	name := listener.Name
+	if name == "" {
+		name = "listener"
+	}
+	scheme := "http"
+	if listener.Https != nil {
+		scheme = "https"
+	}
+	if listener.RedirectToHttps {
+		scheme = "http (redirect to https)"
+	}
+	return fmt.Sprint(name, " ", listener.Network, "://", listener.Address, " ", scheme)
+}
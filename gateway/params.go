@@ -0,0 +1,202 @@
+package gateway
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Bendomey/nucleo-go"
+	"github.com/Bendomey/nucleo-go/errors"
+	"github.com/Bendomey/nucleo-go/payload"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type ParamsSource string
+
+const (
+	ParamsSourceQuery ParamsSource = "query"
+	ParamsSourceBody  ParamsSource = "body"
+	ParamsSourcePath  ParamsSource = "path"
+)
+
+// defaultParamsPrecedence is the "paramsPrecedence" default setting: the query is merged first, then the
+// body and then the path params, so path params override body values which override query values.
+var defaultParamsPrecedence = []ParamsSource{ParamsSourceQuery, ParamsSourceBody, ParamsSourcePath}
+
+// keys of the sources when the params are kept separated.
+var separatedParamsKeys = map[ParamsSource]string{
+	ParamsSourceQuery: "$query",
+	ParamsSourceBody:  "$body",
+	ParamsSourcePath:  "$params",
+}
+
+// paramsFromRequest extract params from the query string, body and alias path params into a payload.
+// The sources are either merged (by precedence) or kept separated under $query, $body and $params.
+// String values are converted to the types of the action params schema, a validation error is
+// returned when they can't be.
+func paramsFromRequest(ginContext *gin.Context, route Route, settings map[string]interface{}, schema map[string]interface{}, logger *log.Entry) nucleo.Payload {
+	// streamed uploads are read part by part when the action is called.
+	if streamsUploads(route, ginContext.Request) {
+		return buildParams(ginContext, route, settings, schema, nil, logger)
+	}
+
+	body, err := parseBody(ginContext.Request, bodyParsers(route, settings))
+	if err != nil {
+		return bodyError(ginContext.Request, err, logger)
+	}
+	return buildParams(ginContext, route, settings, schema, body, logger)
+}
+
+// buildParams merges the query string, the parsed body and the path params into the params payload.
+func buildParams(ginContext *gin.Context, route Route, settings map[string]interface{}, schema map[string]interface{}, body interface{}, logger *log.Entry) nucleo.Payload {
+	parser := queryParser(route, settings)
+
+	query := parser.parse(ginContext.Request.URL.Query())
+	path := paramsFromPath(ginContext.Params)
+
+	// only the text based sources are converted, e.g. json bodies are already typed.
+	fieldErrors := map[string]interface{}{}
+	coerceParams(query, schema, "", fieldErrors)
+	coerceParams(path, schema, "", fieldErrors)
+	if values, isForm := body.(url.Values); isForm {
+		form := parser.parse(values)
+		coerceParams(form, schema, "", fieldErrors)
+		body = form
+	}
+	if len(fieldErrors) > 0 {
+		return payload.New(errors.NewNucleoValidationError(errors.NewNucleoValidationErrorInput{
+			Message: "Invalid params",
+			Data:    fieldErrors,
+		}))
+	}
+
+	sources := map[ParamsSource]interface{}{
+		ParamsSourceQuery: query,
+		ParamsSourceBody:  body,
+		ParamsSourcePath:  path,
+	}
+
+	if separateParams(route, settings) {
+		params := map[string]interface{}{}
+		for source, key := range separatedParamsKeys {
+			params[key] = sources[source]
+		}
+		return payload.New(params)
+	}
+
+	return payload.New(mergeParams(sources, paramsPrecedence(route, settings), logger))
+}
+
+// mergeParams merges the sources in the order of precedence, later sources override the previous ones.
+func mergeParams(sources map[ParamsSource]interface{}, precedence []ParamsSource, logger *log.Entry) interface{} {
+	params := map[string]interface{}{}
+
+	body, bodyIsMap := sources[ParamsSourceBody].(map[string]interface{})
+	if !bodyIsMap && sources[ParamsSourceBody] != nil {
+		query := sources[ParamsSourceQuery].(map[string]interface{})
+		path := sources[ParamsSourcePath].(map[string]interface{})
+		// a non object body (e.g. a json array) is passed as is when there is nothing to merge it with.
+		if len(query) == 0 && len(path) == 0 {
+			return sources[ParamsSourceBody]
+		}
+		logger.Debugln("Request body is not an object, it is passed in the $body param")
+		params["$body"] = sources[ParamsSourceBody]
+	}
+
+	for _, source := range precedence {
+		values := body
+		if source != ParamsSourceBody {
+			values, _ = sources[source].(map[string]interface{})
+		}
+		for name, value := range values {
+			params[name] = value
+		}
+	}
+	return params
+}
+
+// paramsPrecedence returns the route precedence, or the global one.
+func paramsPrecedence(route Route, settings map[string]interface{}) []ParamsSource {
+	if len(route.ParamsPrecedence) > 0 {
+		return route.ParamsPrecedence
+	}
+	precedence, exists := settings["paramsPrecedence"].([]ParamsSource)
+	if exists && len(precedence) > 0 {
+		return precedence
+	}
+	return defaultParamsPrecedence
+}
+
+// separateParams returns true when the params sources should not be merged.
+func separateParams(route Route, settings map[string]interface{}) bool {
+	if route.SeparateParams {
+		return true
+	}
+	separate, _ := settings["separateParams"].(bool)
+	return separate
+}
+
+// readRawBody reads the untouched request body, and puts it back so it can still be parsed.
+func readRawBody(request *http.Request) ([]byte, error) {
+	if request.Body == nil || request.Body == http.NoBody {
+		return []byte{}, nil
+	}
+	rawBody, err := io.ReadAll(request.Body)
+	if err != nil {
+		return nil, err
+	}
+	request.Body = io.NopCloser(bytes.NewReader(rawBody))
+	return rawBody, nil
+}
+
+// withRawRequest adds the raw body and the request headers to the params. Headers names are lower case,
+// the values of repeated headers are joined with ", ".
+func withRawRequest(params nucleo.Payload, rawBody []byte, header http.Header) nucleo.Payload {
+	headers := map[string]interface{}{}
+	for name, values := range header {
+		headers[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+
+	// a non object body is passed as is, it needs a place next to the raw request.
+	if !params.IsMap() {
+		params = payload.New(map[string]interface{}{"$body": params.Value()})
+	}
+	return params.AddMany(map[string]interface{}{
+		"$rawBody": rawBody,
+		"$headers": headers,
+	})
+}
+
+// bodyError returns the error answered when the request body can't be parsed.
+func bodyError(request *http.Request, err error, logger *log.Entry) nucleo.Payload {
+	if err == errUnsupportedMediaType {
+		message := fmt.Sprint("Unsupported media type: ", request.Header.Get("Content-Type"))
+		code := http.StatusUnsupportedMediaType
+		return payload.New(errors.NewNucleoClientError(errors.NewNucleoClientErrorInput{
+			Message: &message,
+			Code:    &code,
+			Type:    "UNSUPPORTED_MEDIA_TYPE",
+		}))
+	}
+
+	logger.Debugln("Error trying to parse request body -> ", err)
+	message := fmt.Sprint("Error trying to parse request body. Error: ", err.Error())
+	return payload.New(errors.NewNucleoClientError(errors.NewNucleoClientErrorInput{
+		Message: &message,
+		Type:    "INVALID_BODY",
+	}))
+}
+
+// paramsFromPath returns the values of the named (:name) and wildcard (*name) path params.
+func paramsFromPath(ginParams gin.Params) map[string]interface{} {
+	params := map[string]interface{}{}
+	for _, param := range ginParams {
+		// wildcard values start with the path separator
+		params[param.Key] = strings.TrimPrefix(param.Value, "/")
+	}
+	return params
+}
@@ -0,0 +1,144 @@
+package gateway
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// QueryParser is the convention used to parse the query string and form values into params.
+// Repeated keys (ids=1&ids=2) are always parsed as arrays.
+type QueryParser struct {
+	// Bracket notation: filter[status]=open -> {"filter": {"status": "open"}},
+	// ids[]=1&ids[]=2 and ids[0]=1&ids[1]=2 -> {"ids": ["1", "2"]}
+	Brackets bool
+
+	// Dot notation: filter.status=open -> {"filter": {"status": "open"}}
+	Dots bool
+
+	// Comma separated arrays: ids=1,2 -> {"ids": ["1", "2"]}
+	Comma bool
+}
+
+// nested keys deeper than this are kept as flat keys.
+const maxQueryDepth = 20
+
+// queryParser returns the route query parser, or the global one.
+func queryParser(route Route, settings map[string]interface{}) QueryParser {
+	if route.QueryParser != nil {
+		return *route.QueryParser
+	}
+	parser, _ := settings["queryParser"].(QueryParser)
+	return parser
+}
+
+// parse converts the query/form values into params, single values are passed as strings.
+func (parser QueryParser) parse(values map[string][]string) map[string]interface{} {
+	// sorted, so conflicting keys (a=1&a[b]=2) always resolve the same way.
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	params := map[string]interface{}{}
+	for _, key := range keys {
+		items := []interface{}{}
+		for _, value := range values[key] {
+			if parser.Comma && strings.Contains(value, ",") {
+				for _, item := range strings.Split(value, ",") {
+					items = append(items, item)
+				}
+				continue
+			}
+			items = append(items, value)
+		}
+		setQueryValue(params, parser.splitKey(key), items)
+	}
+	// the params stay an object, only the nested values are converted.
+	for key, value := range params {
+		params[key] = indexedMapsToArrays(value)
+	}
+	return params
+}
+
+// splitKey returns the path of a nested key, e.g. filter[status] -> [filter status] and ids[] -> [ids ""].
+func (parser QueryParser) splitKey(key string) []string {
+	name, rest := key, ""
+	if parser.Brackets {
+		if index := strings.Index(key, "["); index > 0 && strings.HasSuffix(key, "]") {
+			name, rest = key[:index], key[index:]
+		}
+	}
+
+	segments := []string{name}
+	if parser.Dots && !strings.HasPrefix(name, ".") && !strings.HasSuffix(name, ".") {
+		segments = strings.Split(name, ".")
+	}
+
+	for rest != "" {
+		end := strings.Index(rest, "]")
+		if !strings.HasPrefix(rest, "[") || end < 0 {
+			// malformed, keep the key as is
+			return []string{key}
+		}
+		segments = append(segments, rest[1:end])
+		rest = rest[end+1:]
+	}
+
+	if len(segments) > maxQueryDepth {
+		return []string{key}
+	}
+	return segments
+}
+
+// setQueryValue sets the items at the path. Empty segments (ids[]) append to an array.
+func setQueryValue(params map[string]interface{}, segments []string, items []interface{}) {
+	key := segments[0]
+
+	if len(segments) == 1 || (len(segments) == 2 && segments[1] == "") {
+		existing, _ := params[key].([]interface{})
+		if len(segments) == 2 {
+			params[key] = append(existing, items...)
+		} else if len(items) == 1 {
+			params[key] = items[0]
+		} else {
+			params[key] = items
+		}
+		return
+	}
+
+	child, isMap := params[key].(map[string]interface{})
+	if !isMap {
+		child = map[string]interface{}{}
+		params[key] = child
+	}
+	setQueryValue(child, segments[1:], items)
+}
+
+// indexedMapsToArrays converts the maps with only index keys (ids[0]=1&ids[1]=2) to arrays.
+// Gaps in the indexes are dropped, so huge indexes can't be used to allocate huge arrays.
+func indexedMapsToArrays(value interface{}) interface{} {
+	object, isMap := value.(map[string]interface{})
+	if !isMap {
+		return value
+	}
+
+	indexes := make([]int, 0, len(object))
+	for key, item := range object {
+		object[key] = indexedMapsToArrays(item)
+		if index, err := strconv.Atoi(key); err == nil && index >= 0 && strconv.Itoa(index) == key {
+			indexes = append(indexes, index)
+		}
+	}
+	if len(indexes) == 0 || len(indexes) != len(object) {
+		return object
+	}
+
+	sort.Ints(indexes)
+	items := make([]interface{}, len(indexes))
+	for position, index := range indexes {
+		items[position] = object[strconv.Itoa(index)]
+	}
+	return items
+}
@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQueryParserParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		parser   QueryParser
+		values   map[string][]string
+		expected map[string]interface{}
+	}{
+		{
+			name:     "single and repeated values",
+			values:   map[string][]string{"a": {"1"}, "ids": {"1", "2"}},
+			expected: map[string]interface{}{"a": "1", "ids": []interface{}{"1", "2"}},
+		},
+		{
+			name:     "numeric top-level keys stay an object",
+			parser:   QueryParser{Brackets: true},
+			values:   map[string][]string{"0": {"a"}, "1": {"b"}},
+			expected: map[string]interface{}{"0": "a", "1": "b"},
+		},
+		{
+			name:     "brackets",
+			parser:   QueryParser{Brackets: true},
+			values:   map[string][]string{"filter[status]": {"open"}, "ids[]": {"1", "2"}, "tags[1]": {"b"}, "tags[0]": {"a"}},
+			expected: map[string]interface{}{"filter": map[string]interface{}{"status": "open"}, "ids": []interface{}{"1", "2"}, "tags": []interface{}{"a", "b"}},
+		},
+		{
+			name:     "index gaps are dropped",
+			parser:   QueryParser{Brackets: true},
+			values:   map[string][]string{"ids[0]": {"a"}, "ids[1000000]": {"b"}},
+			expected: map[string]interface{}{"ids": []interface{}{"a", "b"}},
+		},
+		{
+			name:     "padded indexes are keys",
+			parser:   QueryParser{Brackets: true},
+			values:   map[string][]string{"ids[01]": {"a"}, "ids[1]": {"b"}},
+			expected: map[string]interface{}{"ids": map[string]interface{}{"01": "a", "1": "b"}},
+		},
+		{
+			name:     "brackets disabled",
+			values:   map[string][]string{"filter[status]": {"open"}},
+			expected: map[string]interface{}{"filter[status]": "open"},
+		},
+		{
+			name:     "dots",
+			parser:   QueryParser{Dots: true},
+			values:   map[string][]string{"filter.status": {"open"}, ".hidden": {"1"}},
+			expected: map[string]interface{}{"filter": map[string]interface{}{"status": "open"}, ".hidden": "1"},
+		},
+		{
+			name:     "comma",
+			parser:   QueryParser{Comma: true},
+			values:   map[string][]string{"ids": {"1,2", "3"}},
+			expected: map[string]interface{}{"ids": []interface{}{"1", "2", "3"}},
+		},
+		{
+			name:     "malformed brackets are kept",
+			parser:   QueryParser{Brackets: true},
+			values:   map[string][]string{"a[b]c]": {"1"}},
+			expected: map[string]interface{}{"a[b]c]": "1"},
+		},
+		{
+			name:     "conflicting keys",
+			parser:   QueryParser{Brackets: true},
+			values:   map[string][]string{"a": {"1"}, "a[b]": {"2"}},
+			expected: map[string]interface{}{"a": map[string]interface{}{"b": "2"}},
+		},
+		{
+			name:   "too deep keys are kept flat",
+			parser: QueryParser{Brackets: true},
+			values: map[string][]string{
+				"a[1][2][3][4][5][6][7][8][9][10][11][12][13][14][15][16][17][18][19][20]": {"x"},
+			},
+			expected: map[string]interface{}{
+				"a[1][2][3][4][5][6][7][8][9][10][11][12][13][14][15][16][17][18][19][20]": "x",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			params := test.parser.parse(test.values)
+			if !reflect.DeepEqual(params, test.expected) {
+				t.Errorf("parse() = %#v, expected %#v", params, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package gateway
+
+import (
+	goContext "context"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Bendomey/nucleo-go"
+	"github.com/gin-gonic/gin"
+)
+
+// inFlightCall is an action call the gateway is waiting on.
+type inFlightCall struct {
+	action  string
+	path    string
+	started time.Time
+}
+
+// inFlightCalls keeps track of the running action calls, so the ones still
+// running when the shutdown deadline hits can be reported.
+type inFlightCalls struct {
+	mutex  sync.Mutex
+	nextID uint64
+	calls  map[uint64]inFlightCall
+}
+
+func newInFlightCalls() *inFlightCalls {
+	return &inFlightCalls{
+		calls: map[uint64]inFlightCall{},
+	}
+}
+
+// add registers a running call and returns the id used to remove it.
+func (inFlight *inFlightCalls) add(action string, path string) uint64 {
+	inFlight.mutex.Lock()
+	defer inFlight.mutex.Unlock()
+
+	inFlight.nextID++
+	inFlight.calls[inFlight.nextID] = inFlightCall{
+		action:  action,
+		path:    path,
+		started: time.Now(),
+	}
+	return inFlight.nextID
+}
+
+func (inFlight *inFlightCalls) remove(id uint64) {
+	inFlight.mutex.Lock()
+	defer inFlight.mutex.Unlock()
+
+	delete(inFlight.calls, id)
+}
+
+// list returns the running calls, oldest first.
+func (inFlight *inFlightCalls) list() []inFlightCall {
+	inFlight.mutex.Lock()
+	defer inFlight.mutex.Unlock()
+
+	calls := make([]inFlightCall, 0, len(inFlight.calls))
+	for _, call := range inFlight.calls {
+		calls = append(calls, call)
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		return calls[i].started.Before(calls[j].started)
+	})
+	return calls
+}
+
+// readinessProbe tells load balancers whether the gateway accepts traffic.
+type readinessProbe struct {
+	ready atomic.Bool
+
+	// all the listeners are bound.
+	listening atomic.Bool
+}
+
+func (readiness *readinessProbe) handler(ginContext *gin.Context) {
+	if readiness.ready.Load() {
+		ginContext.String(http.StatusOK, "ready")
+		return
+	}
+	ginContext.String(http.StatusServiceUnavailable, "not ready")
+}
+
+// registerReadinessPath exposes the readiness endpoint, outside of the gateway base path.
+func (svc *GatewayService) registerReadinessPath(mainRouter *gin.Engine) {
+	path, exists := svc.settings["readinessPath"].(string)
+	if !exists || path == "" {
+		return
+	}
+	mainRouter.GET(path, svc.readiness.handler)
+}
+
+// startWhenRoutesAreReady builds the initial route table before the servers start listening,
+// so clients never hit a partial route table. The broker already waited for the service
+// Dependencies (WaitForDependenciesTimeout in the broker config) before starting the gateway.
+func (svc *GatewayService) startWhenRoutesAreReady(context nucleo.BrokerContext) {
+	select {
+	case <-svc.stopping:
+		return
+	default:
+	}
+
+	svc.refreshRoutes(context.(nucleo.Context))
+
+	// the listeners are bound before the gateway is flagged ready, so it is never ready without listening.
+	listening := true
+	for _, server := range svc.servers {
+		if err := server.bind(); err != nil {
+			context.Logger().Errorln("Gateway not ready - could not listen on: ", server.listener, " error: ", err)
+			listening = false
+			continue
+		}
+		go svc.startServer(context, server)
+	}
+	svc.readiness.listening.Store(listening)
+	svc.updateReadiness()
+
+	svc.watchRegistry(context)
+	go svc.watchRoutes(context.(nucleo.Context))
+}
+
+// updateReadiness flags the gateway ready once the routes are built and all the listeners are bound.
+// A failed initial routes build is retried on the next refresh, which then flags the gateway ready.
+func (svc *GatewayService) updateReadiness() {
+	svc.readiness.ready.Store(svc.readiness.listening.Load() && svc.routes.router.Load() != nil && !svc.isStopping())
+}
+
+// drain stops the servers gracefully: the gateway is flagged not-ready first, then
+// after the grace period the servers are shut down, waiting for the in-flight calls.
+func (svc *GatewayService) drain(context nucleo.BrokerContext) {
+	svc.readiness.ready.Store(false)
+
+	gracePeriod := svc.durationSetting("drainGracePeriod")
+	if gracePeriod > 0 {
+		context.Logger().Infoln("Gateway draining - waiting ", gracePeriod, " for load balancers to stop sending traffic")
+		time.Sleep(gracePeriod)
+	}
+
+	ctx, cancel := goContext.WithTimeout(goContext.Background(), svc.durationSetting("shutdownTimeout"))
+	defer cancel()
+
+	waitGroup := sync.WaitGroup{}
+	for _, server := range svc.servers {
+		waitGroup.Add(1)
+		go func(server *gatewayServer) {
+			defer waitGroup.Done()
+
+			if err := server.server.Shutdown(ctx); err != nil {
+				context.Logger().Errorln("Error shutting down server ", server.listener.Name, " - error: ", err)
+			}
+			if server.http3Server != nil {
+				server.waitForHttp3Requests(ctx)
+				if err := server.http3Server.Close(); err != nil {
+					context.Logger().Errorln("Error shutting down http3 server ", server.listener.Name, " - error: ", err)
+				}
+			}
+		}(server)
+	}
+	waitGroup.Wait()
+
+	if ctx.Err() != nil {
+		for _, call := range svc.inFlight.list() {
+			context.Logger().Warnln("Gateway shutdown deadline reached while action was still running - action: ", call.action, " path: ", call.path, " running for: ", time.Since(call.started))
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"fmt"
+
+	"github.com/Bendomey/nucleo-go"
+	"github.com/Bendomey/nucleo-go/payload"
+	"github.com/gin-gonic/gin"
+)
+
+// key of the request nucleo context in the gin context.
+const requestContextKey = "gateway.requestContext"
+
+// newRequestContext creates the nucleo context of a request: a child of the broker root context with its own
+// meta and request id, so the user and the response meta of concurrent requests don't leak into each other.
+// The gateway context can't be the parent: it has a request id of its own, which the children inherit.
+// The actions called by the request are children of this context, their caller is the alias or action path.
+// The meta has the identity of the mutual TLS client certificate from the start, so all the hooks see it.
+func (handler *actionHandler) newRequestContext(ginContext *gin.Context) nucleo.Context {
+	delegates, hasDelegates := handler.context.(brokerDelegatesContext)
+	if !hasDelegates {
+		return handler.context
+	}
+	rootContext := delegates.BrokerDelegates().BrokerContext()
+
+	caller := fmt.Sprint(ginContext.Request.Method, " ", ginContext.FullPath())
+	requestContext := rootContext.ChildActionContext(caller, payload.Empty())
+
+	// the child shares the parent meta, it gets a copy instead.
+	meta := copyMeta(rootContext.Meta())
+	// Identity of the mutual TLS client certificate (nil when the client did not send one).
+	meta["clientCertificate"] = clientCertificateInfo(ginContext.Request.TLS)
+	requestContext.UpdateMeta(payload.New(meta))
+	return requestContext.(nucleo.Context)
+}
+
+// requestContext returns the nucleo context of the request.
+func (handler *actionHandler) requestContext(ginContext *gin.Context) nucleo.Context {
+	if context, exists := ginContext.Get(requestContextKey); exists {
+		return context.(nucleo.Context)
+	}
+	return handler.context
+}
+
+// callContext returns a child of the request context for a single call, with a copy of the request meta and
+// the call meta. Options.Meta would be added to the shared request meta, so it would leak into the next calls.
+func (handler *actionHandler) callContext(ginContext *gin.Context, callMeta map[string]interface{}) nucleo.Context {
+	requestContext := handler.requestContext(ginContext)
+	brokerContext, isBrokerContext := requestContext.(nucleo.BrokerContext)
+	if !isBrokerContext {
+		return requestContext
+	}
+
+	callContext := brokerContext.ChildActionContext(brokerContext.ActionName(), payload.Empty())
+	meta := copyMeta(requestContext.Meta())
+	for key, value := range callMeta {
+		meta[key] = value
+	}
+	callContext.UpdateMeta(payload.New(meta))
+	return callContext.(nucleo.Context)
+}
+
+// keepCallMeta adds the meta set by the action of a call context (e.g. $statusCode) to the request meta,
+// without the call meta.
+func (handler *actionHandler) keepCallMeta(ginContext *gin.Context, callContext nucleo.Context, callMeta map[string]interface{}) {
+	requestMeta := handler.requestContext(ginContext).Meta()
+	for key, value := range callContext.Meta().RawMap() {
+		if _, isCallMeta := callMeta[key]; !isCallMeta {
+			requestMeta.Add(key, value)
+		}
+	}
+}
+
+// copyMeta returns a copy of the meta map, the nested values are shared.
+func copyMeta(meta nucleo.Payload) map[string]interface{} {
+	copied := map[string]interface{}{}
+	for key, value := range meta.RawMap() {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,109 @@
+package gateway
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Bendomey/nucleo-go"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// applyResponseMeta sets the response headers, cookies and location from the meta, and returns the status code.
+// $statusCode -> status code of the response (defaults to 200, or 302 when $location is set)
+// $responseType -> Content-Type of the response
+// $responseHeaders -> map of extra headers
+// $location -> Location header, for redirects and created resources
+// $cookies -> array of cookies: {"name", "value", "path", "domain", "maxAge", "expires", "secure", "httpOnly", "sameSite"}
+func (handler *actionHandler) applyResponseMeta(logger *log.Entry, ginContext *gin.Context) int {
+	meta := handler.requestContext(ginContext).Meta()
+	header := ginContext.Writer.Header()
+
+	if responseHeaders := meta.Get("$responseHeaders"); responseHeaders.Exists() && responseHeaders.IsMap() {
+		for name, value := range responseHeaders.Map() {
+			header.Set(name, value.String())
+		}
+	}
+
+	if responseType := metaString(meta, "$responseType"); responseType != "" {
+		header.Set("Content-Type", responseType)
+	}
+
+	for _, cookie := range metaCookies(meta) {
+		http.SetCookie(ginContext.Writer, cookie)
+	}
+
+	statusCode := succesStatusCode
+	location := metaString(meta, "$location")
+	if location != "" {
+		header.Set("Location", location)
+		statusCode = http.StatusFound
+	}
+
+	if code := meta.Get("$statusCode"); code.Exists() {
+		if code.Int() < 100 || code.Int() > 599 {
+			logger.Warnln("Gateway ignored invalid $statusCode - action: ", handler.action, " status code: ", code.Value())
+		} else {
+			statusCode = code.Int()
+		}
+	}
+	return statusCode
+}
+
+// bodyAllowed returns false for the status codes that must not have a body.
+func bodyAllowed(statusCode int) bool {
+	return statusCode >= 200 && statusCode != http.StatusNoContent && statusCode != http.StatusNotModified
+}
+
+// metaString returns the string value of the key, or "" when it is not set.
+func metaString(meta nucleo.Payload, key string) string {
+	value := meta.Get(key)
+	if !value.Exists() {
+		return ""
+	}
+	return value.String()
+}
+
+// metaCookies returns the cookies of the $cookies meta.
+func metaCookies(meta nucleo.Payload) []*http.Cookie {
+	value := meta.Get("$cookies")
+	if !value.Exists() {
+		return nil
+	}
+
+	// local actions can set the cookies directly.
+	if cookies, isCookies := value.Value().([]*http.Cookie); isCookies {
+		return cookies
+	}
+
+	cookies := []*http.Cookie{}
+	for _, item := range value.Array() {
+		cookie := &http.Cookie{
+			Name:     metaString(item, "name"),
+			Value:    metaString(item, "value"),
+			Path:     metaString(item, "path"),
+			Domain:   metaString(item, "domain"),
+			MaxAge:   item.Get("maxAge").Int(),
+			Secure:   item.Get("secure").Bool(),
+			HttpOnly: item.Get("httpOnly").Bool(),
+		}
+		if expires := item.Get("expires"); expires.Exists() {
+			if text, isText := expires.Value().(string); isText {
+				cookie.Expires, _ = time.Parse(time.RFC3339, text)
+			} else {
+				cookie.Expires = expires.Time()
+			}
+		}
+		switch strings.ToLower(metaString(item, "sameSite")) {
+		case "lax":
+			cookie.SameSite = http.SameSiteLaxMode
+		case "strict":
+			cookie.SameSite = http.SameSiteStrictMode
+		case "none":
+			cookie.SameSite = http.SameSiteNoneMode
+		}
+		cookies = append(cookies, cookie)
+	}
+	return cookies
+}
@@ -0,0 +1,244 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Bendomey/nucleo-go"
+	"github.com/Bendomey/nucleo-go/errors"
+	"github.com/Bendomey/nucleo-go/payload"
+	"github.com/gin-gonic/gin"
+	"github.com/ugorji/go/codec"
+)
+
+// ResponseSerializer encodes the action results, it is selected by the Accept header of the request.
+type ResponseSerializer interface {
+	// ContentType of the encoded responses, e.g. "application/json; charset=utf-8".
+	ContentType() string
+
+	// Serialize encodes the action result.
+	Serialize(value interface{}) ([]byte, error)
+}
+
+// defaultResponseSerializers is the "responseSerializers" default setting, used when neither the route nor the settings set them.
+var defaultResponseSerializers = []ResponseSerializer{JSONResponseSerializer{}}
+
+// gin context key of the serializer negotiated for the request.
+const responseSerializerKey = "gateway.responseSerializer"
+
+// responseSerializers returns the route response serializers, or the global ones.
+func responseSerializers(route Route, settings map[string]interface{}) []ResponseSerializer {
+	if len(route.ResponseSerializers) > 0 {
+		return route.ResponseSerializers
+	}
+	serializers, exists := settings["responseSerializers"].([]ResponseSerializer)
+	if exists && len(serializers) > 0 {
+		return serializers
+	}
+	return defaultResponseSerializers
+}
+
+// acceptedType is a media range of the Accept header.
+type acceptedType struct {
+	mediaRange string
+	quality    float64
+}
+
+// negotiateSerializer returns the serializer of the most preferred type of the Accept header.
+// Each serializer gets the quality of the most specific media range matching its type, so
+// "application/xml;q=0, */*" excludes xml. Equal qualities prefer the more specific range, then the
+// serializers order. The first serializer is the default, used when the client accepts anything.
+// Returns false when none of the serializers produces an accepted type.
+func negotiateSerializer(accept string, serializers []ResponseSerializer) (ResponseSerializer, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return serializers[0], true
+	}
+
+	acceptedTypes := parseAccept(accept)
+
+	var best ResponseSerializer
+	bestQuality, bestSpecificity := 0.0, -1
+	for _, serializer := range serializers {
+		mediaType, _, _ := mime.ParseMediaType(serializer.ContentType())
+
+		quality, specificity := 0.0, -1
+		for _, accepted := range acceptedTypes {
+			if matches, _ := path.Match(accepted.mediaRange, mediaType); matches && accepted.specificity() > specificity {
+				quality, specificity = accepted.quality, accepted.specificity()
+			}
+		}
+
+		if quality > bestQuality || (quality == bestQuality && quality > 0 && specificity > bestSpecificity) {
+			best, bestQuality, bestSpecificity = serializer, quality, specificity
+		}
+	}
+	return best, best != nil
+}
+
+// specificity ranks the media ranges: */* < type/* < type/subtype.
+func (accepted acceptedType) specificity() int {
+	switch {
+	case accepted.mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(accepted.mediaRange, "/*"):
+		return 1
+	}
+	return 2
+}
+
+// parseAccept returns the media ranges of the Accept header, q=0 ranges included as they exclude types.
+func parseAccept(accept string) []acceptedType {
+	accepted := []acceptedType{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if value, exists := params["q"]; exists {
+			if quality, err = strconv.ParseFloat(value, 64); err != nil || quality < 0 || quality > 1 {
+				continue
+			}
+		}
+		accepted = append(accepted, acceptedType{mediaRange, quality})
+	}
+	return accepted
+}
+
+// notAcceptableError is answered when none of the serializers produces a type accepted by the client.
+func notAcceptableError(accept string) nucleo.Payload {
+	message := fmt.Sprint("Not acceptable: ", accept)
+	code := http.StatusNotAcceptable
+	return payload.New(errors.NewNucleoClientError(errors.NewNucleoClientErrorInput{
+		Message: &message,
+		Code:    &code,
+		Type:    "NOT_ACCEPTABLE",
+	}))
+}
+
+// responseSerializer returns the serializer negotiated for the request, or the default one.
+func (handler *actionHandler) responseSerializer(ginContext *gin.Context) ResponseSerializer {
+	if serializer, exists := ginContext.Get(responseSerializerKey); exists {
+		return serializer.(ResponseSerializer)
+	}
+	return responseSerializers(handler.route, handler.settings)[0]
+}
+
+// JSONResponseSerializer encodes responses as json.
+type JSONResponseSerializer struct{}
+
+func (JSONResponseSerializer) ContentType() string {
+	return "application/json; charset=utf-8"
+}
+
+func (JSONResponseSerializer) Serialize(value interface{}) ([]byte, error) {
+	return jsonSerializer.PayloadToBytes(payload.New(value)), nil
+}
+
+// MessagePackResponseSerializer encodes responses as MessagePack.
+type MessagePackResponseSerializer struct{}
+
+func (MessagePackResponseSerializer) ContentType() string {
+	return "application/msgpack"
+}
+
+func (MessagePackResponseSerializer) Serialize(value interface{}) ([]byte, error) {
+	handle := &codec.MsgpackHandle{}
+	handle.WriteExt = true
+	return encodeResponse(value, handle)
+}
+
+// CBORResponseSerializer encodes responses as CBOR.
+type CBORResponseSerializer struct{}
+
+func (CBORResponseSerializer) ContentType() string {
+	return "application/cbor"
+}
+
+func (CBORResponseSerializer) Serialize(value interface{}) ([]byte, error) {
+	return encodeResponse(value, &codec.CborHandle{})
+}
+
+// encodeResponse encodes the value with the codec handle.
+func encodeResponse(value interface{}, handle codec.Handle) ([]byte, error) {
+	bts := []byte{}
+	err := codec.NewEncoderBytes(&bts, handle).Encode(value)
+	return bts, err
+}
+
+// XMLResponseSerializer encodes responses as xml, under a <response> root element.
+// Arrays items are <item> elements, and object keys which are not valid element
+// names are <entry key="..."> elements.
+type XMLResponseSerializer struct{}
+
+func (XMLResponseSerializer) ContentType() string {
+	return "application/xml; charset=utf-8"
+}
+
+func (XMLResponseSerializer) Serialize(value interface{}) ([]byte, error) {
+	// go through json, so structs are encoded like they are in json responses.
+	bts, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(bts))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	buffer := bytes.NewBufferString(xml.Header)
+	writeXMLElement(buffer, "response", generic)
+	return buffer.Bytes(), nil
+}
+
+var xmlNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9._-]*$`)
+
+// writeXMLElement writes the value as an element.
+func writeXMLElement(buffer *bytes.Buffer, name string, value interface{}) {
+	startTag, endTag := "<"+name+">", "</"+name+">"
+	if !xmlNameRegex.MatchString(name) || strings.HasPrefix(strings.ToLower(name), "xml") {
+		startTag, endTag = `<entry key="`+xmlEscape(name)+`">`, "</entry>"
+	}
+
+	switch value := value.(type) {
+	case nil:
+		buffer.WriteString(startTag + endTag)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buffer.WriteString(startTag)
+		for _, key := range keys {
+			writeXMLElement(buffer, key, value[key])
+		}
+		buffer.WriteString(endTag)
+	case []interface{}:
+		buffer.WriteString(startTag)
+		for _, item := range value {
+			writeXMLElement(buffer, "item", item)
+		}
+		buffer.WriteString(endTag)
+	default:
+		buffer.WriteString(startTag + xmlEscape(fmt.Sprint(value)) + endTag)
+	}
+}
+
+func xmlEscape(text string) string {
+	buffer := bytes.Buffer{}
+	_ = xml.EscapeText(&buffer, []byte(text))
+	return buffer.String()
+}
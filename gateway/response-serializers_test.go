@@ -0,0 +1,41 @@
+package gateway
+
+import "testing"
+
+func TestNegotiateSerializer(t *testing.T) {
+	serializers := []ResponseSerializer{
+		JSONResponseSerializer{},
+		MessagePackResponseSerializer{},
+		XMLResponseSerializer{},
+	}
+
+	tests := []struct {
+		name       string
+		accept     string
+		expected   ResponseSerializer
+		acceptable bool
+	}{
+		{"no accept header", "", JSONResponseSerializer{}, true},
+		{"anything", "*/*", JSONResponseSerializer{}, true},
+		{"exact type", "application/xml", XMLResponseSerializer{}, true},
+		{"parameters are ignored", "application/xml; charset=utf-8", XMLResponseSerializer{}, true},
+		{"type wildcard", "application/*", JSONResponseSerializer{}, true},
+		{"highest quality", "application/json;q=0.5, application/msgpack", MessagePackResponseSerializer{}, true},
+		{"specific range before wildcard", "*/*, application/xml", XMLResponseSerializer{}, true},
+		{"browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", XMLResponseSerializer{}, true},
+		{"q=0 excludes the type", "application/json;q=0, */*", MessagePackResponseSerializer{}, true},
+		{"equal qualities use the serializers order", "application/xml, application/json", JSONResponseSerializer{}, true},
+		{"invalid ranges are skipped", "???, application/xml;q=abc, application/msgpack", MessagePackResponseSerializer{}, true},
+		{"not acceptable", "text/html", nil, false},
+		{"only excluded types", "*/*;q=0", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			serializer, acceptable := negotiateSerializer(test.accept, serializers)
+			if acceptable != test.acceptable || serializer != test.expected {
+				t.Errorf("negotiateSerializer(%q) = %T, %v, expected %T, %v", test.accept, serializer, acceptable, test.expected, test.acceptable)
+			}
+		})
+	}
+}
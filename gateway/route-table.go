@@ -0,0 +1,227 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Bendomey/nucleo-go"
+	"github.com/gin-gonic/gin"
+)
+
+// routeTable holds the gin engine currently serving the gateway. gin can't remove routes,
+// so when services change a new engine is built and swapped in atomically.
+type routeTable struct {
+	router atomic.Pointer[gin.Engine]
+
+	mutex        sync.Mutex
+	fingerprint  string
+	refreshTimer *time.Timer
+	stopWatcher  chan struct{}
+
+	// removes the registry listeners from the broker bus.
+	unwatchRegistry func()
+}
+
+// serveHTTP dispatches requests to the current gin engine.
+func (svc *GatewayService) serveHTTP(writer http.ResponseWriter, request *http.Request) {
+	router := svc.routes.router.Load()
+	if router == nil {
+		http.Error(writer, "gateway is starting", http.StatusServiceUnavailable)
+		return
+	}
+	router.ServeHTTP(writer, request)
+}
+
+// buildRouter creates a new gin engine with the global middlewares and all the
+// exposed permitted actions/aliases of the given services.
+func (svc *GatewayService) buildRouter(context nucleo.Context, services []map[string]interface{}) (router *gin.Engine, err error) {
+	// gin panics on invalid or duplicate paths, don't let it take the gateway down.
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			router = nil
+			err = fmt.Errorf("%v", recovered)
+		}
+	}()
+
+	router = gin.Default()
+
+	// readiness endpoint is registered before the global middlewares, so they don't apply to it.
+	svc.registerReadinessPath(router)
+
+	// register all global middlewares
+	svc.registerGlobalMiddlewares(router)
+
+	// we have a global path that user's can set their gateways up with.
+	gatewayRouter := svc.registerBaseGatewayPath(router)
+
+	svc.registerActionsRouter(context, gatewayRouter, services)
+
+	// static files are served for the paths the actions don't handle.
+	svc.registerAssets(router, gatewayRouter.BasePath())
+
+	return router, nil
+}
+
+// refreshRoutes rebuilds the route table when the available services/actions changed.
+func (svc *GatewayService) refreshRoutes(context nucleo.Context) {
+	svc.routes.mutex.Lock()
+	defer svc.routes.mutex.Unlock()
+
+	if svc.isStopping() {
+		return
+	}
+
+	services := fetchServices(context)
+	fingerprint := servicesFingerprint(services)
+	if svc.routes.router.Load() != nil && fingerprint == svc.routes.fingerprint {
+		return
+	}
+
+	router, err := svc.buildRouter(context, services)
+	if err != nil {
+		context.Logger().Errorln("Could not build the gateway routes, keeping the previous ones - error: ", err)
+		return
+	}
+
+	svc.routes.router.Store(router)
+	svc.routes.fingerprint = fingerprint
+	svc.updateReadiness()
+
+	logRouteRegistration, logRouteRegistrationExists := svc.settings["logRouteRegistration"].(nucleo.LogLevelType)
+	if logRouteRegistrationExists {
+		getLogger(logRouteRegistration, context.Logger())("Gateway routes rebuilt - endpoints: ", len(router.Routes()))
+	}
+}
+
+// scheduleRoutesRefresh refreshes the routes once the registry settles, so a burst of
+// service changes (e.g. a rolling deploy) only triggers a single rebuild.
+func (svc *GatewayService) scheduleRoutesRefresh() {
+	svc.routes.mutex.Lock()
+	defer svc.routes.mutex.Unlock()
+
+	if svc.isStopping() {
+		return
+	}
+	if svc.routes.refreshTimer != nil {
+		svc.routes.refreshTimer.Stop()
+	}
+	svc.routes.refreshTimer = time.AfterFunc(svc.durationSetting("routesRefreshDebounce"), func() {
+		svc.refreshRoutes(svc.context.(nucleo.Context))
+	})
+}
+
+// watchRoutes periodically checks the registry for service changes, in case a change event was missed.
+func (svc *GatewayService) watchRoutes(context nucleo.Context) {
+	interval := svc.durationSetting("routesRefreshInterval")
+	if interval <= 0 {
+		return
+	}
+
+	stop := make(chan struct{})
+	svc.routes.mutex.Lock()
+	if svc.isStopping() {
+		svc.routes.mutex.Unlock()
+		return
+	}
+	svc.routes.stopWatcher = stop
+	svc.routes.mutex.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			svc.refreshRoutes(context)
+		}
+	}
+}
+
+// stopWatchingRoutes stops the pending refresh and the periodic check.
+func (svc *GatewayService) stopWatchingRoutes() {
+	svc.routes.mutex.Lock()
+	defer svc.routes.mutex.Unlock()
+
+	if svc.routes.refreshTimer != nil {
+		svc.routes.refreshTimer.Stop()
+	}
+	if svc.routes.stopWatcher != nil {
+		close(svc.routes.stopWatcher)
+		svc.routes.stopWatcher = nil
+	}
+	if svc.routes.unwatchRegistry != nil {
+		svc.routes.unwatchRegistry()
+		svc.routes.unwatchRegistry = nil
+	}
+}
+
+// registry events that trigger a routes refresh.
+var registryEvents = []string{"$registry.service.added", "$registry.service.removed", "$node.disconnected"}
+
+// brokerDelegatesContext is implemented by the nucleo contexts, it gives access to the broker.
+type brokerDelegatesContext interface {
+	BrokerDelegates() *nucleo.BrokerDelegates
+}
+
+// watchRegistry subscribes to the registry changes on the broker bus, to keep the routes in sync with the
+// available services. Mixin events are not used: nucleo only merges them when the service declares events of its own.
+func (svc *GatewayService) watchRegistry(context nucleo.BrokerContext) {
+	delegates, hasDelegates := context.(brokerDelegatesContext)
+	if !hasDelegates {
+		return
+	}
+
+	// also called when the initial build failed, so it is retried as soon as the services change.
+	onServicesChanged := func(...interface{}) {
+		svc.scheduleRoutesRefresh()
+	}
+
+	svc.routes.mutex.Lock()
+	defer svc.routes.mutex.Unlock()
+
+	if svc.isStopping() {
+		return
+	}
+	bus := delegates.BrokerDelegates().Bus()
+	for _, event := range registryEvents {
+		bus.On(event, onServicesChanged)
+	}
+	// the bus matches the listeners by their code, with several gateways on a broker the first one matching is removed.
+	svc.routes.unwatchRegistry = func() {
+		for _, event := range registryEvents {
+			bus.RemoveListener(event, onServicesChanged)
+		}
+	}
+}
+
+// isStopping returns true once the gateway is stopped, the routes are not refreshed anymore.
+func (svc *GatewayService) isStopping() bool {
+	select {
+	case <-svc.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// servicesFingerprint identifies the set of available actions and their params schemas, to skip
+// rebuilds when nothing changed. The schemas are part of it as the params are coerced with them.
+func servicesFingerprint(services []map[string]interface{}) string {
+	actionsSchemas := []string{}
+	for _, service := range services {
+		actions, _ := service["actions"].(map[string]map[string]interface{})
+		for name, action := range actions {
+			// fmt prints the maps sorted by key.
+			actionsSchemas = append(actionsSchemas, fmt.Sprint(name, action["params"]))
+		}
+	}
+	sort.Strings(actionsSchemas)
+	return strings.Join(actionsSchemas, ",")
+}
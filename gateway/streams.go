@@ -0,0 +1,171 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// size of the chunks read from the streams returned by the actions.
+const streamChunkSize = 32 << 10
+
+// isStream returns true when the action result is written as a stream: an io.Reader, a channel or raw bytes.
+func isStream(value interface{}) bool {
+	switch value.(type) {
+	case io.Reader, []byte:
+		return true
+	}
+	return value != nil && reflect.TypeOf(value).Kind() == reflect.Chan && reflect.TypeOf(value).ChanDir()&reflect.RecvDir != 0
+}
+
+// writeStream writes the stream returned by the action as a chunked response, flushed as the data
+// arrives. The content type and headers (e.g. Content-Disposition) are set with the response meta. Readers implementing io.Closer are closed when done or when the client disconnects.
+func (handler *actionHandler) writeStream(logger *log.Entry, ginContext *gin.Context, value interface{}) {
+	header := ginContext.Writer.Header()
+	statusCode := handler.applyResponseMeta(logger, ginContext)
+
+	if header.Get("Content-Type") == "" {
+		contentType := "application/octet-stream"
+		if reflect.TypeOf(value).Kind() == reflect.Chan && !isBytesChannel(value) {
+			// items other than bytes are written as json lines
+			contentType = "application/x-ndjson"
+		}
+		header.Set("Content-Type", contentType)
+	}
+	if bts, isBytes := value.([]byte); isBytes {
+		header.Set("Content-Length", strconv.Itoa(len(bts)))
+	}
+	ginContext.Writer.WriteHeader(statusCode)
+
+	writeTimeout, _ := handler.settings["writeTimeout"].(time.Duration)
+	writer := &streamWriter{
+		ginContext:   ginContext,
+		controller:   http.NewResponseController(ginContext.Writer),
+		writeTimeout: writeTimeout,
+	}
+
+	var err error
+	switch value := value.(type) {
+	case []byte:
+		err = writer.write(value)
+	case io.Reader:
+		err = writer.copyReader(value)
+	default:
+		err = writer.copyChannel(reflect.ValueOf(value))
+	}
+
+	if err != nil && ginContext.Request.Context().Err() == nil {
+		logger.Errorln("Gateway error writing the stream - action: ", handler.action, " error: ", err)
+	}
+}
+
+// streamWriter writes and flushes the chunks of a stream, until the client disconnects.
+type streamWriter struct {
+	ginContext   *gin.Context
+	controller   *http.ResponseController
+	writeTimeout time.Duration
+}
+
+func (writer *streamWriter) write(chunk []byte) error {
+	// the server write timeout applies to each chunk instead of the whole stream, so long downloads are not cut.
+	if writer.writeTimeout > 0 {
+		_ = writer.controller.SetWriteDeadline(time.Now().Add(writer.writeTimeout))
+	}
+	if _, err := writer.ginContext.Writer.Write(chunk); err != nil {
+		return err
+	}
+	writer.ginContext.Writer.Flush()
+	return nil
+}
+
+// copyReader writes the reader to the response. The reader is closed when done, or as soon as the client
+// disconnects so the action can stop producing data.
+func (writer *streamWriter) copyReader(reader io.Reader) error {
+	if closer, isCloser := reader.(io.Closer); isCloser {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-writer.ginContext.Request.Context().Done():
+			case <-done:
+			}
+			closer.Close()
+		}()
+	}
+
+	buffer := make([]byte, streamChunkSize)
+	for {
+		read, err := reader.Read(buffer)
+		if read > 0 {
+			if err := writer.write(buffer[:read]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// copyChannel writes the channel items to the response until it is closed. When the client disconnects,
+// the channel is drained in the background so the action is not blocked sending.
+func (writer *streamWriter) copyChannel(channel reflect.Value) error {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: channel},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(writer.ginContext.Request.Context().Done())},
+	}
+
+	for {
+		chosen, item, ok := reflect.Select(cases)
+		if chosen == 1 {
+			go drainChannel(channel)
+			return writer.ginContext.Request.Context().Err()
+		}
+		if !ok {
+			return nil
+		}
+
+		chunk, err := channelChunk(item.Interface())
+		if err != nil {
+			go drainChannel(channel)
+			return err
+		}
+		if err := writer.write(chunk); err != nil {
+			go drainChannel(channel)
+			return err
+		}
+	}
+}
+
+// channelChunk returns the bytes written for a channel item: bytes and strings as is, other values as a json line.
+func channelChunk(item interface{}) ([]byte, error) {
+	switch item := item.(type) {
+	case []byte:
+		return item, nil
+	case string:
+		return []byte(item), nil
+	}
+	chunk, err := JSONResponseSerializer{}.Serialize(item)
+	return append(chunk, '\n'), err
+}
+
+func isBytesChannel(value interface{}) bool {
+	element := reflect.TypeOf(value).Elem()
+	return element.Kind() == reflect.String || (element.Kind() == reflect.Slice && element.Elem().Kind() == reflect.Uint8)
+}
+
+func drainChannel(channel reflect.Value) {
+	for {
+		if _, ok := channel.Recv(); !ok {
+			return
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package gateway
+
+import (
+	goErrors "errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Bendomey/nucleo-go"
+	"github.com/Bendomey/nucleo-go/errors"
+	"github.com/Bendomey/nucleo-go/payload"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type UploadSettings struct {
+	// Maximum number of files per request. 0 for no limit.
+	MaxFiles int
+
+	// Maximum size of each file, in bytes. 0 for no limit.
+	MaxFileSize int64
+}
+
+// size of the non file fields of streamed uploads, they are kept in memory.
+const maxUploadFieldSize = 1 << 20
+
+// errFileTooLarge is returned by the upload streams when the file is larger than the route limit.
+var errFileTooLarge = goErrors.New("file too large")
+
+// streamsUploads returns true when the request is a multipart upload that should be streamed to the action.
+func streamsUploads(route Route, request *http.Request) bool {
+	if route.Uploads == nil {
+		return false
+	}
+	contentType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	return contentType == "multipart/form-data"
+}
+
+// uploadStream is the file part passed to the action, it fails once the file exceeds the size limit.
+type uploadStream struct {
+	part           *multipart.Part
+	maxSize        int64
+	size           int64
+	exceeded       bool
+	extendDeadline func()
+}
+
+func (stream *uploadStream) Read(buffer []byte) (int, error) {
+	stream.extendDeadline()
+	if stream.exceeded {
+		return 0, errFileTooLarge
+	}
+	if stream.maxSize > 0 {
+		remaining := stream.maxSize - stream.size
+		if remaining <= 0 {
+			// anything left is over the limit
+			if read, err := stream.part.Read(make([]byte, 1)); read == 0 {
+				return 0, err
+			}
+			stream.exceeded = true
+			return 0, errFileTooLarge
+		}
+		if int64(len(buffer)) > remaining {
+			buffer = buffer[:remaining]
+		}
+	}
+	read, err := stream.part.Read(buffer)
+	stream.size += int64(read)
+	return read, err
+}
+
+// callWithUploads calls the action once per file of the multipart request, with the file
+// streamed in the $stream param and its filename, mimetype and fieldname in the meta.
+// The fields sent before a file are passed as params. Requests without files call the action
+// once with the fields. Returns the result of the call, or the results of all calls in an array.
+func (handler *actionHandler) callWithUploads(ginContext *gin.Context, logger *log.Entry) nucleo.Payload {
+	reader, err := ginContext.Request.MultipartReader()
+	if err != nil {
+		return bodyError(ginContext.Request, err, logger)
+	}
+
+	// the server read timeout applies to each chunk instead of the whole request, so long uploads are not cut.
+	readTimeout, _ := handler.settings["readTimeout"].(time.Duration)
+	controller := http.NewResponseController(ginContext.Writer)
+	extendDeadline := func() {
+		if readTimeout > 0 {
+			_ = controller.SetReadDeadline(time.Now().Add(readTimeout))
+		}
+	}
+
+	limits := handler.route.Uploads
+	fields := url.Values{}
+	results := []interface{}{}
+	files := 0
+
+	for {
+		extendDeadline()
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return bodyError(ginContext.Request, err, logger)
+		}
+
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxUploadFieldSize+1))
+			if err != nil {
+				return bodyError(ginContext.Request, err, logger)
+			}
+			if len(value) > maxUploadFieldSize {
+				return payloadTooLargeError(fmt.Sprint("Field too large: ", part.FormName()))
+			}
+			fields.Add(part.FormName(), string(value))
+			continue
+		}
+
+		files++
+		if limits.MaxFiles > 0 && files > limits.MaxFiles {
+			return payloadTooLargeError(fmt.Sprint("Too many files, the maximum is ", limits.MaxFiles))
+		}
+
+		params := buildParams(ginContext, handler.route, handler.settings, handler.paramsSchema, fields, logger)
+		if _, isAnError := resultIsAnError(params); isAnError {
+			return params
+		}
+
+		stream := &uploadStream{part: part, maxSize: limits.MaxFileSize, extendDeadline: extendDeadline}
+		fileMeta := map[string]interface{}{
+			"filename":  part.FileName(),
+			"mimetype":  part.Header.Get("Content-Type"),
+			"fieldname": part.FormName(),
+		}
+		callContext := handler.callContext(ginContext, fileMeta)
+		result := <-callContext.Call(handler.action, params.Add("$stream", stream))
+		handler.keepCallMeta(ginContext, callContext, fileMeta)
+
+		// the rest of the file is skipped, so the next part can be read.
+		if _, err := io.Copy(io.Discard, stream); err != nil && err != errFileTooLarge {
+			return bodyError(ginContext.Request, err, logger)
+		}
+		if stream.exceeded {
+			return payloadTooLargeError(fmt.Sprint("File too large: ", part.FileName(), ", the maximum is ", limits.MaxFileSize, " bytes"))
+		}
+		if _, isAnError := resultIsAnError(result); isAnError {
+			return result
+		}
+		results = append(results, result.Value())
+	}
+
+	if files == 0 {
+		params := buildParams(ginContext, handler.route, handler.settings, handler.paramsSchema, fields, logger)
+		if _, isAnError := resultIsAnError(params); isAnError {
+			return params
+		}
+		return <-handler.requestContext(ginContext).Call(handler.action, params)
+	}
+	if len(results) == 1 {
+		return payload.New(results[0])
+	}
+	return payload.New(results)
+}
+
+// payloadTooLargeError is answered when an upload exceeds the route limits.
+func payloadTooLargeError(message string) nucleo.Payload {
+	code := http.StatusRequestEntityTooLarge
+	return payload.New(errors.NewNucleoClientError(errors.NewNucleoClientErrorInput{
+		Message: &message,
+		Code:    &code,
+		Type:    "PAYLOAD_TOO_LARGE",
+	}))
+}
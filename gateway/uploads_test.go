@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Bendomey/nucleo-go"
+	"github.com/gin-gonic/gin"
+)
+
+func TestUploadsMeta(t *testing.T) {
+	files := nucleo.ServiceSchema{
+		Name: "files",
+		Actions: []nucleo.Action{
+			{Name: "upload", Handler: func(context nucleo.Context, params nucleo.Payload) interface{} {
+				context.Meta().Add("$statusCode", http.StatusCreated)
+				return context.Meta().Get("fieldname").String() + ":" + context.Meta().Get("filename").String()
+			}},
+		},
+	}
+	var leakedMeta []string
+	onAfterCall := func(context nucleo.Context, ginContext *gin.Context, route Route, response nucleo.Payload) {
+		for _, key := range []string{"filename", "mimetype", "fieldname"} {
+			if context.Meta().Get(key).Exists() {
+				leakedMeta = append(leakedMeta, key)
+			}
+		}
+	}
+
+	handler := startGateway(t, GatewayMixin{}, map[string]interface{}{
+		"routes": []Route{{
+			Path:        "/api",
+			Uploads:     &UploadSettings{},
+			OnAfterCall: &onAfterCall,
+			Aliases:     map[string]string{"POST /upload": "files.upload"},
+		}},
+	}, files)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for field, name := range map[string]string{"avatar": "a.png", "cover": "b.png"} {
+		part, _ := writer.CreateFormFile(field, name)
+		_, _ = part.Write([]byte(name))
+	}
+	_ = writer.Close()
+
+	request := httptest.NewRequest(http.MethodPost, "/api/upload", body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusCreated {
+		t.Errorf("status code %d, expected the $statusCode set by the action", recorder.Code)
+	}
+	for _, expected := range []string{"avatar:a.png", "cover:b.png"} {
+		if !bytes.Contains(recorder.Body.Bytes(), []byte(expected)) {
+			t.Errorf("response %s, expected %s", recorder.Body.String(), expected)
+		}
+	}
+	if len(leakedMeta) > 0 {
+		t.Errorf("the file meta %v was left in the request meta", leakedMeta)
+	}
+}
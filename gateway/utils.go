@@ -56,7 +56,7 @@ func shouldIncludeAction(whitelist []string, action string) bool {
 	return false
 }
 
-func createActionHandlers(route Route, actions []string, router *gin.RouterGroup, authenticate *AuthenticateMethodsFunc, authorize *AuthorizeMethodFunc) []*actionHandler {
+func createActionHandlers(route Route, actions []string, paramsSchemas map[string]map[string]interface{}, router *gin.RouterGroup, authenticate *AuthenticateMethodsFunc, authorize *AuthorizeMethodFunc) []*actionHandler {
 	// before we create the endpoints, lets go further and then filter by aliases.
 	// There are two scenarios:
 	// Scenario 1: A user would want all their actions to be endpoints. MappingPolicy -> all
@@ -91,6 +91,7 @@ func createActionHandlers(route Route, actions []string, router *gin.RouterGroup
 			action:       action,
 			router:       router,
 			route:        route,
+			paramsSchema: paramsSchemas[action],
 			authenticate: authenticate,
 			authorize:    authorize,
 		})
@@ -0,0 +1,365 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Bendomey/nucleo-go"
+	"github.com/gin-gonic/gin"
+)
+
+// settings that can't be left out (nil).
+var requiredSettings = []string{"ip", "port", "path", "routes"}
+
+// settingsValidator collects the problems of the gateway settings, so they are reported all at once.
+type settingsValidator struct {
+	problems []string
+}
+
+func (validator *settingsValidator) add(format string, args ...interface{}) {
+	validator.problems = append(validator.problems, fmt.Sprintf(format, args...))
+}
+
+// validateSettings checks the settings, routes, aliases and whitelists before the gateway starts.
+// Returns a single error listing all the problems, or nil.
+func (svc *GatewayService) validateSettings() error {
+	validator := &settingsValidator{}
+
+	validator.validateTypes(svc.settings)
+
+	if port, isInt := svc.settings["port"].(int); isInt && (port < 0 || port > 65535) {
+		validator.add("port: %d is not a valid port", port)
+	}
+	if path, isString := svc.settings["path"].(string); isString && !strings.HasPrefix(path, "/") {
+		validator.add("path: %q must start with /", path)
+	}
+	if path, isString := svc.settings["readinessPath"].(string); isString && path != "" && !strings.HasPrefix(path, "/") {
+		validator.add("readinessPath: %q must start with /", path)
+	}
+	if onError, exists := svc.settings["onError"]; exists && onError != nil {
+		if _, isFunc := onError.(func(context *gin.Context, response nucleo.Payload)); !isFunc {
+			validator.add("onError: must be a func(*gin.Context, nucleo.Payload), got %T", onError)
+		}
+	}
+	if precedence, isPrecedence := svc.settings["paramsPrecedence"].([]ParamsSource); isPrecedence {
+		validator.validateParamsPrecedence("paramsPrecedence", precedence)
+	}
+	if statusCodes, isStatusCodes := svc.settings["errorStatusCodes"].(map[string]int); isStatusCodes {
+		for _, errorType := range sortedKeys(statusCodes) {
+			if statusCode := statusCodes[errorType]; statusCode < 400 || statusCode > 599 {
+				validator.add("errorStatusCodes: %d is not a http error status (%s)", statusCode, errorType)
+			}
+		}
+	}
+	if httpsSettings, isHttps := svc.settings["https"].(*HttpsSettings); isHttps && httpsSettings != nil {
+		validator.validateHttps("https", httpsSettings)
+	}
+	if listeners, isListeners := svc.settings["listeners"].([]Listener); isListeners {
+		validator.validateListeners(listeners)
+	}
+	if assets, isAssets := svc.settings["assets"].([]Assets); isAssets {
+		validator.validateAssets(assets)
+	}
+	if parsers, isParsers := svc.settings["bodyParsers"].([]BodyParser); isParsers {
+		validator.validateBodyParsers("bodyParsers", parsers)
+	}
+
+	if routes, isRoutes := svc.settings["routes"].([]Route); isRoutes {
+		basePath, _ := svc.settings["path"].(string)
+		readinessPath, _ := svc.settings["readinessPath"].(string)
+		validator.validateRoutes(basePath, readinessPath, routes)
+	}
+
+	if len(validator.problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid gateway settings:\n  - %s", strings.Join(validator.problems, "\n  - "))
+}
+
+// validateTypes checks the settings have the type of their default value.
+func (validator *settingsValidator) validateTypes(settings map[string]interface{}) {
+	for _, name := range requiredSettings {
+		if settings[name] == nil {
+			validator.add("%s: is required", name)
+		}
+	}
+
+	for _, name := range sortedKeys(defaultSettings) {
+		value := settings[name]
+		if value == nil {
+			continue
+		}
+		expected := reflect.TypeOf(defaultSettings[name])
+		if reflect.TypeOf(value) != expected {
+			validator.add("%s: must be of type %s, got %T", name, expected, value)
+		}
+	}
+}
+
+func (validator *settingsValidator) validateParamsPrecedence(name string, precedence []ParamsSource) {
+	for _, source := range precedence {
+		if _, isSource := separatedParamsKeys[source]; !isSource {
+			validator.add("%s: unknown params source %q", name, source)
+		}
+	}
+}
+
+func (validator *settingsValidator) validateListeners(listeners []Listener) {
+	for index, listener := range listeners {
+		name := listener.Name
+		if name == "" {
+			name = fmt.Sprint("#", index)
+		}
+		if listener.Address == "" {
+			validator.add("listener %s: address is required", name)
+		}
+		if listener.Network != "" && listener.Network != NetworkTCP && listener.Network != NetworkUnix {
+			validator.add("listener %s: unknown network %q", name, listener.Network)
+		}
+		if listener.RedirectStatusCode != 0 && listener.RedirectStatusCode != http.StatusMovedPermanently && listener.RedirectStatusCode != http.StatusPermanentRedirect {
+			validator.add("listener %s: redirect status code must be 301 or 308, got %d", name, listener.RedirectStatusCode)
+		}
+		if listener.Https != nil {
+			validator.validateHttps("listener "+name+": https", listener.Https)
+		}
+		if listener.H2C && listener.Https != nil {
+			validator.add("listener %s: h2c is only available on plain http listeners", name)
+		}
+		if listener.HTTP3 && (listener.Https == nil || (listener.Network != "" && listener.Network != NetworkTCP)) {
+			validator.add("listener %s: http3 is only available on https tcp listeners", name)
+		}
+		if listener.RedirectToHttps && !hasHttpsListener(listeners) {
+			validator.add("listener %s: redirects to https, but there is no https tcp listener", name)
+		}
+	}
+}
+
+// hasHttpsListener returns true when one of the listeners can be the target of the https redirects.
+func hasHttpsListener(listeners []Listener) bool {
+	for _, listener := range listeners {
+		if listener.Https != nil && !listener.RedirectToHttps && (listener.Network == "" || listener.Network == NetworkTCP) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateHttps checks the https settings without reading the files, they are loaded when the gateway starts.
+func (validator *settingsValidator) validateHttps(name string, settings *HttpsSettings) {
+	if settings.CertFile == "" && settings.KeyFile == "" {
+		if len(settings.Cert) == 0 || len(settings.Key) == 0 {
+			validator.add("%s: needs either CertFile/KeyFile or Cert/Key", name)
+		}
+	} else if settings.CertFile == "" || settings.KeyFile == "" {
+		validator.add("%s: needs both CertFile and KeyFile", name)
+	}
+	if settings.MinVersion != 0 && (settings.MinVersion < tls.VersionTLS10 || settings.MinVersion > tls.VersionTLS13) {
+		validator.add("%s: unknown min version 0x%04x", name, settings.MinVersion)
+	}
+	for _, cipherSuite := range settings.CipherSuites {
+		if !knownCipherSuite(cipherSuite) {
+			validator.add("%s: unknown cipher suite 0x%04x", name, cipherSuite)
+		}
+	}
+	if clientAuth := settings.ClientAuth; clientAuth != nil {
+		if clientAuth.CAFile == "" && len(clientAuth.CA) == 0 {
+			validator.add("%s: client auth needs either CAFile or CA", name)
+		}
+		if clientAuth.Mode != "" && clientAuth.Mode != ClientAuthRequire && clientAuth.Mode != ClientAuthVerifyIfGiven {
+			validator.add("%s: unknown client auth mode %q", name, clientAuth.Mode)
+		}
+	}
+}
+
+func knownCipherSuite(id uint16) bool {
+	for _, cipherSuite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if cipherSuite.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (validator *settingsValidator) validateAssets(assets []Assets) {
+	for index, asset := range assets {
+		if asset.FS == nil && asset.Folder == "" {
+			validator.add("assets #%d (%s): Folder or FS is required", index, asset.Path)
+		}
+		if strings.Contains(asset.Index, "/") {
+			validator.add("assets #%d (%s): index %q must be a file name", index, asset.Path, asset.Index)
+		}
+	}
+}
+
+func (validator *settingsValidator) validateBodyParsers(name string, parsers []BodyParser) {
+	for index, parser := range parsers {
+		switch parser := parser.(type) {
+		case nil:
+			validator.add("%s: parser #%d is nil", name, index)
+		case MultipartBodyParser:
+			if parser.MaxMemory < 0 {
+				validator.add("%s: multipart max memory can't be negative", name)
+			}
+		case *MultipartBodyParser:
+			if parser == nil {
+				validator.add("%s: parser #%d is nil", name, index)
+			} else if parser.MaxMemory < 0 {
+				validator.add("%s: multipart max memory can't be negative", name)
+			}
+		}
+	}
+}
+
+// validateRoutes checks each route, and that the aliases endpoints don't conflict in the gin router:
+// registered twice, or with different wildcards at the same place.
+func (validator *settingsValidator) validateRoutes(basePath, readinessPath string, routes []Route) {
+	// method -> endpoints registered for it
+	endpoints := map[string][]endpoint{}
+
+	// the readiness endpoint is registered on the same router, outside of the base path.
+	if readinessPath != "" {
+		endpoints[http.MethodGet] = append(endpoints[http.MethodGet], endpoint{readinessPath, "readinessPath"})
+	}
+
+	for index, route := range routes {
+		name := route.Name
+		if name == "" {
+			name = fmt.Sprint("#", index)
+		}
+		prefix := fmt.Sprint("route ", name, ": ")
+
+		if route.Path != "" && !strings.HasPrefix(route.Path, "/") {
+			validator.add("%spath %q must start with /", prefix, route.Path)
+		}
+		if route.MappingPolicy != "" && route.MappingPolicy != MappingPolicyAll && route.MappingPolicy != MappingPolicyRestrict {
+			validator.add("%sunknown mapping policy %q", prefix, route.MappingPolicy)
+		}
+		for _, item := range route.Whitelist {
+			if _, err := regexp.Compile(item); err != nil && item != "**" && !actionWildCardRegex.MatchString(item) && !serviceWildCardRegex.MatchString(item) {
+				validator.add("%sinvalid whitelist item %q: %v", prefix, item, err)
+			}
+		}
+		validator.validateParamsPrecedence(prefix+"paramsPrecedence", route.ParamsPrecedence)
+		validator.validateBodyParsers(prefix+"bodyParsers", route.BodyParsers)
+		if route.Uploads != nil && (route.Uploads.MaxFiles < 0 || route.Uploads.MaxFileSize < 0) {
+			validator.add("%supload limits can't be negative", prefix)
+		}
+
+		// only one alias is registered per action.
+		actionAliases := map[string]string{}
+		for _, alias := range sortedKeys(route.Aliases) {
+			action := route.Aliases[alias]
+			methods, path, err := parseAlias(alias)
+			if err != nil {
+				validator.add("%s%v", prefix, err)
+				continue
+			}
+			if action == "" {
+				validator.add("%salias %q has no action", prefix, alias)
+				continue
+			}
+			if other, exists := actionAliases[action]; exists {
+				validator.add("%saction %s has several aliases (%q and %q), only one alias per action is supported", prefix, action, other, alias)
+				continue
+			}
+			actionAliases[action] = alias
+
+			fullPath := joinPaths(basePath, route.Path, path)
+			// the paths generated for the other actions of the route would all be under the catch-all.
+			if route.MappingPolicy != MappingPolicyRestrict && isCatchAllOf(joinPaths(basePath, route.Path), fullPath) {
+				validator.add("%salias %q: the catch-all %s conflicts with the paths of the mapping policy all, use the mapping policy restrict", prefix, alias, fullPath)
+			}
+			for _, method := range methods {
+				if conflict := conflictingEndpoint(endpoints[method], fullPath); conflict != nil {
+					validator.add("%salias %q: %s %s conflicts with %s %s of %s", prefix, alias, method, fullPath, method, conflict.path, conflict.owner)
+					continue
+				}
+				endpoints[method] = append(endpoints[method], endpoint{fullPath, fmt.Sprint("route ", name)})
+			}
+		}
+
+		for _, alias := range sortedKeys(route.AliasSettings) {
+			if _, exists := route.Aliases[alias]; !exists {
+				validator.add("%salias settings of %q: no such alias", prefix, alias)
+			}
+		}
+	}
+}
+
+// endpoint is a path registered in the gin router, and what registered it.
+type endpoint struct {
+	path  string
+	owner string
+}
+
+// conflictingEndpoint returns the endpoint the gin router would refuse to register the path next to.
+func conflictingEndpoint(endpoints []endpoint, path string) *endpoint {
+	for index := range endpoints {
+		if pathsConflict(endpoints[index].path, path) {
+			return &endpoints[index]
+		}
+	}
+	return nil
+}
+
+// pathsConflict reports whether gin panics when registering both paths for the same method:
+// same path, different wildcard names at the same segment (/items/:id and /items/:name),
+// or a catch-all next to any other segment (/files/*path and /files/new).
+// A static segment next to a named wildcard is allowed (/items/new and /items/:id).
+func pathsConflict(path, other string) bool {
+	if path == other {
+		return true
+	}
+	segments, otherSegments := strings.Split(path, "/"), strings.Split(other, "/")
+	for index := 0; index < len(segments) && index < len(otherSegments); index++ {
+		segment, otherSegment := segments[index], otherSegments[index]
+		if segment == otherSegment {
+			continue
+		}
+		if strings.HasPrefix(segment, "*") || strings.HasPrefix(otherSegment, "*") {
+			return true
+		}
+		return strings.HasPrefix(segment, ":") && strings.HasPrefix(otherSegment, ":")
+	}
+	return false
+}
+
+// isCatchAllOf returns true when the path is a catch-all right under the route path, e.g. /api/*path of /api.
+func isCatchAllOf(routePath, path string) bool {
+	return strings.HasPrefix(path, strings.TrimSuffix(routePath, "/")+"/*")
+}
+
+// parseAlias returns the methods and path of an alias: "METHOD /path", or "/path" for all methods.
+func parseAlias(alias string) ([]string, string, error) {
+	parts := strings.Split(strings.TrimSpace(alias), " ")
+	switch len(parts) {
+	case 1:
+		return validMethods, parts[0], nil
+	case 2:
+		method := strings.ToUpper(parts[0])
+		if !validMethod(method) {
+			return nil, "", fmt.Errorf("alias %q: unknown method %s", alias, parts[0])
+		}
+		return []string{method}, parts[1], nil
+	}
+	return nil, "", fmt.Errorf("alias %q: must be \"METHOD /path\" or \"/path\"", alias)
+}
+
+// joinPaths joins the path segments the way the route groups do.
+func joinPaths(paths ...string) string {
+	return "/" + strings.Trim(strings.Replace(strings.Join(paths, "/"), "//", "/", -1), "/")
+}
+
+func sortedKeys[Value any](values map[string]Value) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
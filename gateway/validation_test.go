@@ -0,0 +1,160 @@
+package gateway
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPathsConflict(t *testing.T) {
+	tests := []struct {
+		path     string
+		other    string
+		expected bool
+	}{
+		{"/items/:id", "/items/:id", true},
+		{"/items/:id", "/items/:name", true},
+		{"/items/:id/a", "/items/:name/b", true},
+		{"/items/:id/a", "/items/:id/b", false},
+		{"/items/:id", "/items/new", false},
+		{"/items/*path", "/items/x", true},
+		{"/items/x/y", "/items/*path", true},
+		{"/files/*path", "/files/:id", true},
+		{"/a/*p", "/a/*q", true},
+		{"/a/*p", "/a", false},
+		{"/a/:id", "/b/:name", false},
+		{"/a/:id/x", "/a/:id", false},
+	}
+
+	for _, test := range tests {
+		if conflict := pathsConflict(test.path, test.other); conflict != test.expected {
+			t.Errorf("pathsConflict(%q, %q) = %v, expected %v", test.path, test.other, conflict, test.expected)
+		}
+	}
+}
+
+func TestValidateRoutes(t *testing.T) {
+	tests := []struct {
+		name     string
+		basePath string
+		routes   []Route
+		expected []string
+	}{
+		{
+			"distinct aliases",
+			"/api",
+			[]Route{{Path: "/items", Aliases: map[string]string{"GET /:id": "items.get", "GET /new": "items.new", "POST /:id": "items.update"}}},
+			nil,
+		},
+		{
+			"conflicting wildcards",
+			"/api",
+			[]Route{{Name: "items", Path: "/items", Aliases: map[string]string{"GET /:id": "items.get", "GET /:name": "items.find"}}},
+			[]string{`route items: alias "GET /:name": GET /api/items/:name conflicts with GET /api/items/:id of route items`},
+		},
+		{
+			"conflicting wildcards across routes",
+			"/api",
+			[]Route{
+				{Name: "a", Path: "/items", MappingPolicy: MappingPolicyRestrict, Aliases: map[string]string{"/*path": "items.get"}},
+				{Name: "b", Path: "/items", Aliases: map[string]string{"DELETE /:id": "items.remove"}},
+			},
+			[]string{`route b: alias "DELETE /:id": DELETE /api/items/:id conflicts with DELETE /api/items/*path of route a`},
+		},
+		{
+			"catch-all with the mapping policy all",
+			"/api",
+			[]Route{
+				{Name: "all", Path: "/files", Aliases: map[string]string{"GET /*path": "files.get"}},
+				{Name: "nested", Path: "/items", Aliases: map[string]string{"GET /:id/*rest": "items.get"}},
+			},
+			[]string{`route all: alias "GET /*path": the catch-all /api/files/*path conflicts with the paths of the mapping policy all, use the mapping policy restrict`},
+		},
+		{
+			"readiness path",
+			"/",
+			[]Route{{Name: "root", Aliases: map[string]string{"GET /ready": "health.ready"}}},
+			[]string{`route root: alias "GET /ready": GET /ready conflicts with GET /ready of readinessPath`},
+		},
+	}
+
+	for _, test := range tests {
+		validator := &settingsValidator{}
+		validator.validateRoutes(test.basePath, "/ready", test.routes)
+		if strings.Join(validator.problems, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("%s: problems %q, expected %q", test.name, validator.problems, test.expected)
+		}
+	}
+}
+
+func TestValidateSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		expected []string
+	}{
+		{
+			"assets",
+			map[string]interface{}{"assets": []Assets{{Path: "/static"}, {Folder: "./public", Index: "pages/index.html"}, {Folder: "./public"}}},
+			[]string{`assets #0 (/static): Folder or FS is required`, `assets #1 (): index "pages/index.html" must be a file name`},
+		},
+		{
+			"https",
+			map[string]interface{}{"https": &HttpsSettings{CertFile: "cert.pem", MinVersion: 0x0200, CipherSuites: []uint16{0xffff}, ClientAuth: &ClientAuthSettings{Mode: "maybe"}}},
+			[]string{
+				`https: needs both CertFile and KeyFile`,
+				`https: unknown min version 0x0200`,
+				`https: unknown cipher suite 0xffff`,
+				`https: client auth needs either CAFile or CA`,
+				`https: unknown client auth mode "maybe"`,
+			},
+		},
+		{
+			"listeners",
+			map[string]interface{}{"listeners": []Listener{
+				{Name: "web", Address: ":80", HTTP3: true},
+				{Name: "h2c", Address: ":8443", Https: &HttpsSettings{Cert: []byte("cert")}, H2C: true},
+			}},
+			[]string{
+				`listener web: http3 is only available on https tcp listeners`,
+				`listener h2c: https: needs either CertFile/KeyFile or Cert/Key`,
+				`listener h2c: h2c is only available on plain http listeners`,
+			},
+		},
+		{
+			"redirect without https listener",
+			map[string]interface{}{"listeners": []Listener{
+				{Name: "web", Address: ":80", RedirectToHttps: true},
+				{Name: "socket", Network: NetworkUnix, Address: "/tmp/gateway.sock", Https: &HttpsSettings{CertFile: "cert.pem", KeyFile: "key.pem"}},
+			}},
+			[]string{`listener web: redirects to https, but there is no https tcp listener`},
+		},
+		{
+			"body parsers",
+			map[string]interface{}{
+				"bodyParsers": []BodyParser{nil, MultipartBodyParser{MaxMemory: -1}},
+				"routes":      []Route{{Name: "api", BodyParsers: []BodyParser{&MultipartBodyParser{MaxMemory: -1}}}},
+			},
+			[]string{
+				`bodyParsers: parser #0 is nil`,
+				`bodyParsers: multipart max memory can't be negative`,
+				`route api: bodyParsers: multipart max memory can't be negative`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		settings := map[string]interface{}{"ip": "0.0.0.0", "port": 3100, "path": "/", "routes": []Route{}}
+		for name, value := range test.settings {
+			settings[name] = value
+		}
+		svc := &GatewayService{settings: settings}
+
+		var problems []string
+		if err := svc.validateSettings(); err != nil {
+			problems = strings.Split(strings.TrimPrefix(err.Error(), "invalid gateway settings:\n  - "), "\n  - ")
+		}
+		if strings.Join(problems, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("%s: problems %q, expected %q", test.name, problems, test.expected)
+		}
+	}
+}